@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DefaultAsyncLoggerSize is the default buffer size of AsyncLogger.
+const DefaultAsyncLoggerSize = 1024
+
+// OverflowPolicy is the AsyncLogger behavior when the buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks Print until there is room in the buffer.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the line being printed.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest buffered line.
+	OverflowDropOldest
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop newest"
+	case OverflowDropOldest:
+		return "drop oldest"
+	}
+	return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+}
+
+// AsyncLogger is a LoggerInterface that queues the lines in a bounded ring
+// buffer, written to the Logger by a background goroutine. So a slow log
+// output does not add latency to the responses. At most size lines are
+// buffered, plus the line being written.
+//
+// Call Close on shutdown to write the buffered lines.
+type AsyncLogger struct {
+	logger LoggerInterface
+	policy OverflowPolicy
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	buf     []string
+	head    int
+	size    int
+	writing bool
+	closed  bool
+	dropped uint64
+	done    chan struct{}
+}
+
+// NewAsyncLogger creates an AsyncLogger writing to logger and starts the
+// background writer. If size <= 0, uses DefaultAsyncLoggerSize.
+func NewAsyncLogger(logger LoggerInterface, size int, policy OverflowPolicy) *AsyncLogger {
+	if size <= 0 {
+		size = DefaultAsyncLoggerSize
+	}
+	l := &AsyncLogger{
+		logger: logger,
+		policy: policy,
+		buf:    make([]string, size),
+		done:   make(chan struct{}),
+	}
+	l.cond = sync.NewCond(&l.mu)
+	go l.run()
+	return l
+}
+
+// Print queues the line. After Close, the line is written synchronously,
+// after the buffered lines.
+func (l *AsyncLogger) Print(v ...interface{}) {
+	line := fmt.Sprint(v...)
+	l.mu.Lock()
+	if l.size == len(l.buf) && !l.closed {
+		switch l.policy {
+		case OverflowDropNewest:
+			l.dropped++
+			l.mu.Unlock()
+			return
+		case OverflowDropOldest:
+			l.buf[l.head] = ""
+			l.head = (l.head + 1) % len(l.buf)
+			l.size--
+			l.dropped++
+		default:
+			for l.size == len(l.buf) && !l.closed {
+				l.cond.Wait()
+			}
+		}
+	}
+	if l.closed {
+		l.mu.Unlock()
+		// the background writer may still be writing the buffered lines
+		<-l.done
+		l.logger.Print(line)
+		return
+	}
+	l.buf[(l.head+l.size)%len(l.buf)] = line
+	l.size++
+	l.cond.Broadcast()
+	l.mu.Unlock()
+}
+
+func (l *AsyncLogger) run() {
+	defer close(l.done)
+	for {
+		l.mu.Lock()
+		for l.size == 0 && !l.closed {
+			l.cond.Wait()
+		}
+		if l.size == 0 {
+			l.mu.Unlock()
+			return
+		}
+		line := l.buf[l.head]
+		l.buf[l.head] = ""
+		l.head = (l.head + 1) % len(l.buf)
+		l.size--
+		l.writing = true
+		l.cond.Broadcast()
+		l.mu.Unlock()
+
+		l.logger.Print(line)
+
+		l.mu.Lock()
+		l.writing = false
+		l.cond.Broadcast()
+		l.mu.Unlock()
+	}
+}
+
+// Flush waits until the buffered lines are written.
+func (l *AsyncLogger) Flush() {
+	l.mu.Lock()
+	for (l.size > 0 || l.writing) && !l.closed {
+		l.cond.Wait()
+	}
+	l.mu.Unlock()
+	if l.isClosed() {
+		<-l.done
+	}
+}
+
+func (l *AsyncLogger) isClosed() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.closed
+}
+
+// Close writes the buffered lines and stops the background writer.
+func (l *AsyncLogger) Close() error {
+	l.mu.Lock()
+	l.closed = true
+	l.cond.Broadcast()
+	l.mu.Unlock()
+	<-l.done
+	return nil
+}
+
+// Dropped returns the number of lines dropped by the overflow policy.
+func (l *AsyncLogger) Dropped() uint64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.dropped
+}
+
+// Len returns the number of buffered lines.
+func (l *AsyncLogger) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.size
+}
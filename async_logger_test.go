@@ -0,0 +1,149 @@
+package middleware
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// gateLogger records the lines. Each Print signals entered and waits the gate
+// to be closed.
+type gateLogger struct {
+	gate    chan struct{}
+	entered chan string
+	mu      sync.Mutex
+	lines   []string
+}
+
+func newGateLogger() *gateLogger {
+	return &gateLogger{gate: make(chan struct{}), entered: make(chan string, 100)}
+}
+
+func (l *gateLogger) Print(v ...interface{}) {
+	line := fmt.Sprint(v...)
+	l.entered <- line
+	<-l.gate
+	l.mu.Lock()
+	l.lines = append(l.lines, line)
+	l.mu.Unlock()
+}
+
+func (l *gateLogger) Lines() []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestAsyncLogger_Overflow(t *testing.T) {
+	tests := []struct {
+		policy  OverflowPolicy
+		want    []string
+		dropped uint64
+	}{
+		{OverflowDropNewest, []string{"a", "b", "c"}, 2},
+		{OverflowDropOldest, []string{"a", "d", "e"}, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			out := newGateLogger()
+			l := NewAsyncLogger(out, 2, tt.policy)
+			l.Print("a")
+			<-out.entered
+			// "a" is being written, the buffer receives 2 lines
+			for _, line := range []string{"b", "c", "d", "e"} {
+				l.Print(line)
+			}
+			if l.Dropped() != tt.dropped || l.Len() != 2 {
+				t.Errorf("got %d dropped and %d buffered, want %d and 2", l.Dropped(), l.Len(), tt.dropped)
+			}
+			close(out.gate)
+			l.Flush()
+			if got := out.Lines(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+			l.Close()
+		})
+	}
+}
+
+func TestAsyncLogger_Block(t *testing.T) {
+	out := newGateLogger()
+	l := NewAsyncLogger(out, 1, OverflowBlock)
+	l.Print("a")
+	<-out.entered
+	l.Print("b")
+	done := make(chan struct{})
+	go func() {
+		l.Print("c")
+		close(done)
+	}()
+	select {
+	case <-done:
+		t.Fatal("Print did not block with a full buffer")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(out.gate)
+	<-done
+	l.Flush()
+	if want := []string{"a", "b", "c"}; !reflect.DeepEqual(out.Lines(), want) {
+		t.Errorf("got %q, want %q", out.Lines(), want)
+	}
+	if l.Dropped() != 0 {
+		t.Errorf("got %d dropped, want 0", l.Dropped())
+	}
+	l.Close()
+}
+
+func TestAsyncLogger_Close(t *testing.T) {
+	out := newGateLogger()
+	close(out.gate)
+	l := NewAsyncLogger(out, 0, OverflowBlock)
+	for i := 0; i < 10; i++ {
+		l.Print(i)
+	}
+	l.Close()
+	if got := out.Lines(); len(got) != 10 || got[9] != "9" {
+		t.Fatalf("got %q after Close, want 0 to 9", got)
+	}
+	// written synchronously after Close
+	l.Print("closed")
+	if got := out.Lines(); got[len(got)-1] != "closed" {
+		t.Errorf("got %q after Close, want closed last", got)
+	}
+	l.Flush()
+}
+
+func TestAsyncLogger_PrintWhileClosing(t *testing.T) {
+	out := newGateLogger()
+	l := NewAsyncLogger(out, 0, OverflowBlock)
+	l.Print("a")
+	<-out.entered
+	l.Print("b")
+	closed := make(chan struct{})
+	go func() {
+		l.Close()
+		close(closed)
+	}()
+	for !l.isClosed() {
+		time.Sleep(time.Millisecond)
+	}
+	printed := make(chan struct{})
+	go func() {
+		l.Print("late")
+		close(printed)
+	}()
+	// "late" waits the buffered lines
+	select {
+	case <-out.entered:
+		t.Fatal("line written while closing")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(out.gate)
+	<-closed
+	<-printed
+	if want := []string{"a", "b", "late"}; !reflect.DeepEqual(out.Lines(), want) {
+		t.Errorf("got %q, want %q", out.Lines(), want)
+	}
+}
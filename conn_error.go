@@ -0,0 +1,18 @@
+//go:build !plan9
+// +build !plan9
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+)
+
+// isConnError reports whether the write error is caused by the client
+// connection closed.
+func isConnError(err error) bool {
+	return errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, net.ErrClosed) || errors.Is(err, context.Canceled)
+}
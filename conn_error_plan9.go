@@ -0,0 +1,16 @@
+//go:build plan9
+// +build plan9
+
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net"
+)
+
+// isConnError reports whether the write error is caused by the client
+// connection closed. Plan 9 has no EPIPE and ECONNRESET errnos.
+func isConnError(err error) bool {
+	return errors.Is(err, net.ErrClosed) || errors.Is(err, context.Canceled)
+}
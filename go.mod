@@ -1,6 +1,6 @@
 module github.com/moisespsena-go/middleware
 
-go 1.15
+go 1.21
 
 require (
 	github.com/go-chi/chi v1.5.4
@@ -13,3 +13,11 @@ require (
 	github.com/moisespsena-go/tracederror v0.0.1
 	github.com/unapu-go/error-utils v0.0.1
 )
+
+require (
+	github.com/mattn/go-colorable v0.1.7 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/phayes/permbits v0.0.0-20190612203442-39d7c581d2ee // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sys v0.0.0-20210423082822-04245dca01da // indirect
+)
@@ -0,0 +1,211 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// IgnoreRule is a rule matching the requests not logged.
+type IgnoreRule struct {
+	// Ignore is false for the '-' rules, which accept the matched requests.
+	Ignore bool
+	Kind   string
+	Value  string
+	match  func(r *http.Request) bool
+}
+
+func (this *IgnoreRule) String() string {
+	if this.Ignore {
+		return "+" + this.Kind + ":" + this.Value
+	}
+	return "-" + this.Kind + ":" + this.Value
+}
+
+// Match reports whether the rule matches the request.
+func (this *IgnoreRule) Match(r *http.Request) bool {
+	return this.match(r)
+}
+
+// IgnoreRules is an ordered list of ignore rules. The first matched rule
+// decides whether the request is logged.
+//
+// Rules are written as "[+|-]kind:value", like the Extensions.UpdateStrings
+// values: '+' or no sign ignores the matched requests, '-' accepts them.
+// Kinds are:
+//
+//	prefix:/assets/              the path has the prefix
+//	glob:/static/*.css           the path matches the path.Match pattern
+//	regex:^/api/v\d+/ping$       the path matches the regular expression
+//	ext:css                      the path extension
+//	method:OPTIONS,HEAD          the request method is one of
+//	header:X-Health-Check        the request header is present
+//	header:User-Agent=kube-probe*  the request header matches the '*' wildcard
+//	cidr:10.0.0.0/8              the remote IP is in the network
+//
+// Example: "-prefix:/assets/logo", "prefix:/assets/", "method:OPTIONS".
+type IgnoreRules []*IgnoreRule
+
+// ParseIgnoreRules parses the rules values.
+func ParseIgnoreRules(values ...string) (rules IgnoreRules, err error) {
+	for _, v := range values {
+		if v == "" {
+			continue
+		}
+		var rule *IgnoreRule
+		if rule, err = parseIgnoreRule(v); err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return
+}
+
+// MustIgnoreRules is like ParseIgnoreRules but panics on error.
+func MustIgnoreRules(values ...string) IgnoreRules {
+	rules, err := ParseIgnoreRules(values...)
+	if err != nil {
+		panic(err)
+	}
+	return rules
+}
+
+func parseIgnoreRule(v string) (rule *IgnoreRule, err error) {
+	rule = &IgnoreRule{Ignore: true}
+	switch v[0] {
+	case '-':
+		rule.Ignore = false
+		fallthrough
+	case '+':
+		v = v[1:]
+	}
+	pos := strings.IndexByte(v, ':')
+	if pos <= 0 {
+		return nil, fmt.Errorf("middleware: bad ignore rule %q: expected kind:value", v)
+	}
+	rule.Kind, rule.Value = v[:pos], v[pos+1:]
+	value := rule.Value
+
+	switch rule.Kind {
+	case "prefix":
+		rule.match = func(r *http.Request) bool {
+			return strings.HasPrefix(r.URL.Path, value)
+		}
+	case "glob":
+		if _, err = path.Match(value, ""); err != nil {
+			return nil, fmt.Errorf("middleware: bad ignore rule %q: %v", v, err)
+		}
+		rule.match = func(r *http.Request) bool {
+			ok, _ := path.Match(value, r.URL.Path)
+			return ok
+		}
+	case "regex":
+		var re *regexp.Regexp
+		if re, err = regexp.Compile(value); err != nil {
+			return nil, fmt.Errorf("middleware: bad ignore rule %q: %v", v, err)
+		}
+		rule.match = func(r *http.Request) bool {
+			return re.MatchString(r.URL.Path)
+		}
+	case "ext":
+		ext := "." + strings.TrimPrefix(value, ".")
+		rule.match = func(r *http.Request) bool {
+			return path.Ext(r.URL.Path) == ext
+		}
+	case "method":
+		methods := strings.Split(strings.ToUpper(value), ",")
+		rule.match = func(r *http.Request) bool {
+			for _, m := range methods {
+				if r.Method == m {
+					return true
+				}
+			}
+			return false
+		}
+	case "header":
+		name, pattern := value, ""
+		if pos := strings.IndexByte(value, '='); pos > 0 {
+			name, pattern = value[:pos], value[pos+1:]
+		}
+		name = http.CanonicalHeaderKey(name)
+		if pattern == "" {
+			rule.match = func(r *http.Request) bool {
+				return len(r.Header[name]) > 0
+			}
+		} else {
+			rule.match = func(r *http.Request) bool {
+				for _, hv := range r.Header[name] {
+					if wildcardMatch(pattern, hv) {
+						return true
+					}
+				}
+				return false
+			}
+		}
+	case "cidr":
+		var network *net.IPNet
+		if _, network, err = net.ParseCIDR(value); err != nil {
+			return nil, fmt.Errorf("middleware: bad ignore rule %q: %v", v, err)
+		}
+		rule.match = func(r *http.Request) bool {
+			ip := remoteIP(r)
+			return ip != nil && network.Contains(ip)
+		}
+	default:
+		return nil, fmt.Errorf("middleware: bad ignore rule %q: unknown kind %q", v, rule.Kind)
+	}
+	return
+}
+
+// Match returns the first rule matched by the request, or nil.
+func (this IgnoreRules) Match(r *http.Request) *IgnoreRule {
+	for _, rule := range this {
+		if rule.match(r) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// acceptRequest reports whether the request is not ignored by the rules,
+// falling back to the ignored extensions when no rule matches.
+func acceptRequest(rules IgnoreRules, ignore Extensions, r *http.Request) bool {
+	if rule := rules.Match(r); rule != nil {
+		return !rule.Ignore
+	}
+	return acceptExtension(ignore, r)
+}
+
+// remoteIP returns the IP of the request RemoteAddr.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// wildcardMatch reports whether s matches the pattern, where '*' matches any
+// sequence of characters.
+func wildcardMatch(pattern, s string) bool {
+	parts := strings.Split(pattern, "*")
+	if len(parts) == 1 {
+		return pattern == s
+	}
+	if !strings.HasPrefix(s, parts[0]) {
+		return false
+	}
+	s = s[len(parts[0]):]
+	last := parts[len(parts)-1]
+	for _, part := range parts[1 : len(parts)-1] {
+		pos := strings.Index(s, part)
+		if pos < 0 {
+			return false
+		}
+		s = s[pos+len(part):]
+	}
+	return strings.HasSuffix(s, last)
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	rules := MustIgnoreRules(
+		"-prefix:/assets/logo",
+		"prefix:/assets/",
+		"+glob:/static/*.css",
+		`regex:^/api/v\d+/ping$`,
+		"method:options,HEAD",
+		"header:User-Agent=kube-probe/*",
+		"header:X-Health-Check",
+		"cidr:10.1.0.0/16",
+	)
+	tests := []struct {
+		method, target, header, remote string
+		want                           bool
+	}{
+		{"GET", "/assets/app.js", "", "", false},
+		{"GET", "/assets/logo.png", "", "", true},
+		{"GET", "/static/a.css", "", "", false},
+		{"GET", "/static/a/b.txt", "", "", true},
+		{"GET", "/api/v2/ping", "", "", false},
+		{"OPTIONS", "/x", "", "", false},
+		{"GET", "/x", "User-Agent", "", true},
+		{"GET", "/x", "X-Health-Check", "", false},
+		{"GET", "/x", "", "10.1.2.3:80", false},
+		{"GET", "/x", "", "10.2.2.3:80", true},
+		{"GET", "/x.png", "", "", false},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.target, nil)
+		switch tt.header {
+		case "User-Agent":
+			r.Header.Set("User-Agent", "Mozilla/5.0")
+		case "X-Health-Check":
+			r.Header.Set("X-Health-Check", "1")
+		}
+		if tt.remote != "" {
+			r.RemoteAddr = tt.remote
+		}
+		if got := acceptRequest(rules, DefaultLoggerExtensionsIgnore, r); got != tt.want {
+			t.Errorf("%s %s %s %s: got %v, want %v", tt.method, tt.target, tt.header, tt.remote, got, tt.want)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("User-Agent", "kube-probe/1.27")
+	if acceptRequest(rules, nil, r) {
+		t.Error("kube-probe user agent accepted")
+	}
+
+	for _, bad := range []string{"prefix", "foo:bar", "regex:(", "cidr:10.0.0.0", "glob:["} {
+		if _, err := ParseIgnoreRules(bad); err == nil {
+			t.Errorf("%q: expected error", bad)
+		}
+	}
+}
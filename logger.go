@@ -3,6 +3,7 @@ package middleware
 import (
 	"bytes"
 	"context"
+	"fmt"
 	"io"
 	"log"
 	"net"
@@ -40,17 +41,41 @@ var (
 
 // NewDefaultRequestLogFormatter create request logger using default config
 func NewDefaultRequestLogFormatter(out, err io.Writer, prefix string, ignore ...Extensions) *DefaultLogAndPanicFormatter {
-	var ignoreExts Extensions
-	if len(ignore) == 0 {
-		ignoreExts = DefaultLoggerExtensionsIgnore
-	} else {
-		ignoreExts.Update(ignore...)
-	}
 	return &DefaultLogAndPanicFormatter{
-		Logger:           log.New(out, prefix, log.LstdFlags),
-		PanicLogger:      log.New(err, prefix, log.LstdFlags),
-		IgnoreExtensions: ignoreExts,
+		Logger:             log.New(out, prefix, log.LstdFlags),
+		PanicLogger:        log.New(err, prefix, log.LstdFlags),
+		LogFormatterConfig: newLogFormatterConfig(ignore...),
+	}
+}
+
+// LogFormatterConfig is the requests filter and the redaction config of the
+// LogFormatters of this package.
+type LogFormatterConfig struct {
+	// IgnoreExtensions is the request path extensions not logged.
+	IgnoreExtensions Extensions
+	// IgnoreRules are checked before IgnoreExtensions. See IgnoreRules.
+	IgnoreRules IgnoreRules
+	// Redactor masks the sensitive data. Default is DefaultRedactor.
+	Redactor *Redactor
+}
+
+// newLogFormatterConfig returns the config ignoring the extensions, or the
+// DefaultLoggerExtensionsIgnore if empty.
+func newLogFormatterConfig(ignore ...Extensions) LogFormatterConfig {
+	if len(ignore) == 0 {
+		return LogFormatterConfig{IgnoreExtensions: DefaultLoggerExtensionsIgnore}
 	}
+	return LogFormatterConfig{IgnoreExtensions: Extensions{}.Update(ignore...)}
+}
+
+// Accept reports whether the request is not ignored by the IgnoreRules or
+// the IgnoreExtensions.
+func (c *LogFormatterConfig) Accept(r *http.Request) bool {
+	return acceptRequest(c.IgnoreRules, c.IgnoreExtensions, r)
+}
+
+func (c *LogFormatterConfig) redactor() *Redactor {
+	return redactorOf(c.Redactor)
 }
 
 // Logger is a middleware that logs the start and end of each request, along
@@ -65,22 +90,142 @@ func Logger(next http.Handler) http.Handler {
 	return DefaultLogger(next)
 }
 
-// RequestLogger returns a logger handler using a custom LogFormatter.
-func RequestLogger(f LogFormatter) func(next http.Handler) http.Handler {
+// RequestLoggerOpts is the optional configuration of RequestLogger.
+type RequestLoggerOpts struct {
+	// BodyCapture enables the request and response body capture for debug.
+	// The captured bodies are passed to ResponseLogEntry.WriteResponse.
+	BodyCapture *BodyCaptureOpts
+	// Sampler decides which completed requests are logged. See Sampling.
+	Sampler Sampler
+	// LogStart writes a request started line, if the entry is a
+	// ProgressLogEntry.
+	LogStart bool
+	// StillRunningAfter writes a still running line when the request is not
+	// completed after it, if the entry is a ProgressLogEntry. Zero disables.
+	//
+	// The progress lines are not written for the IgnoreRoutes and for the
+	// requests dropped by a RequestSampler, decided before the handler runs.
+	// When the decision is only known after the response, as with a Filter,
+	// a Sampler that is not a RequestSampler or IgnoreRoutes outside a chi
+	// router, the lines are held back and written with the request line.
+	StillRunningAfter time.Duration
+	// InFlight registers the requests in progress.
+	InFlight *InFlightRegistry
+	// SkipUnwritten skips the requests that never wrote a status, instead of
+	// logging them with a ResponseInfo.PseudoStatus.
+	SkipUnwritten bool
+	// IgnoreRoutes is the chi route patterns not logged, like "/health".
+	IgnoreRoutes []string
+	// Filter decides after the response whether the request is logged. When
+	// set, the requests not accepted by the LogFormatter are also served
+	// through the logger, so the filter can still log them. See ResponseFilter.
+	Filter ResponseFilter
+}
+
+// ResponseFilter reports whether the request is logged. Accepted is whether
+// the LogFormatter accepted the request and its route was not ignored.
+type ResponseFilter func(r *http.Request, info *ResponseInfo, accepted bool) bool
+
+// FilterFailed returns a ResponseFilter that logs the accepted requests and
+// the not accepted requests with status greater or equals to minStatus.
+func FilterFailed(minStatus int) ResponseFilter {
+	return func(r *http.Request, info *ResponseInfo, accepted bool) bool {
+		return accepted || info.Status >= minStatus || info.Panicked
+	}
+}
+
+// RequestLogger returns a logger handler using a custom LogFormatter. The
+// optional RequestLoggerOpts enables the body capture and the other extra
+// behaviors, without it each accepted request is logged once.
+func RequestLogger(f LogFormatter, opts ...*RequestLoggerOpts) func(next http.Handler) http.Handler {
+	opt := &RequestLoggerOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+	var capturer *bodyCapturer
+	if opt.BodyCapture != nil {
+		capturer = newBodyCapturer(opt.BodyCapture)
+	}
+	var ignoreRoutes map[string]bool
+	if len(opt.IgnoreRoutes) > 0 {
+		ignoreRoutes = make(map[string]bool, len(opt.IgnoreRoutes))
+		for _, route := range opt.IgnoreRoutes {
+			ignoreRoutes[route] = true
+		}
+	}
+	// progressLines reports whether the progress lines of the request are
+	// written and whether they are held back until the request is logged.
+	progressLines := func(r *http.Request) (write, hold bool) {
+		hold = opt.Filter != nil
+		if ignoreRoutes == nil && opt.Sampler == nil {
+			return true, hold
+		}
+		route, routed := matchRoutePattern(r)
+		if ignoreRoutes[route] {
+			return false, false
+		}
+		if s, ok := opt.Sampler.(RequestSampler); ok {
+			if !s.SampleRequest(r, route) {
+				return false, false
+			}
+		} else if opt.Sampler != nil {
+			hold = true
+		}
+		return true, hold || (ignoreRoutes != nil && !routed)
+	}
+
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
-			if f.Accept(r) {
+			if opt.InFlight != nil {
+				defer opt.InFlight.Add(r, time.Now())()
+			}
+			if accepted := f.Accept(r); accepted || opt.Filter != nil {
 				var (
-					entry = f.NewLogEntry(r)
-					ww    = middleware.NewWrapResponseWriter(w, r.ProtoMajor)
-					t1    = time.Now()
+					entry     = f.NewLogEntry(r)
+					ww, rec   = newResponseRecorder(w)
+					t1        = time.Now()
+					completed bool
+					progress  *progressWriter
 				)
+				if accepted && (opt.LogStart || opt.StillRunningAfter > 0) {
+					if write, hold := progressLines(r); write {
+						progress = newProgressWriter(entry, opt.LogStart, opt.StillRunningAfter, t1, hold)
+					}
+				}
+				stopWatch := rec.watchClient(r.Context())
 				defer func() {
-					if ww.Status() > 0 {
-						entry.Write(ww.Status(), ww.BytesWritten(), time.Since(t1))
+					stopWatch()
+					progress.stop()
+					if rec.Status() == 0 && opt.SkipUnwritten {
+						return
+					}
+					info := rec.Info(t1)
+					info.Panicked = !completed
+					info.RoutePattern, info.URLParams = RoutePattern(r), URLParams(r)
+					if ignoreRoutes[info.RoutePattern] {
+						accepted = false
+					}
+					if info.Status == 0 {
+						info.setPseudoStatus(rec.hijacked)
+					}
+					if opt.Filter != nil {
+						accepted = opt.Filter(r, info, accepted)
 					}
+					if !accepted {
+						return
+					}
+					if opt.Sampler != nil && !opt.Sampler.Sample(r, info) {
+						return
+					}
+					progress.flush()
+					WriteLogEntry(entry, info)
 				}()
-				next.ServeHTTP(ww, WithLogEntry(r, entry))
+				r = WithLogEntry(r, entry)
+				if capturer != nil && accepted {
+					rec.captureBody(capturer, r)
+				}
+				next.ServeHTTP(ww, r)
+				completed = true
 			} else {
 				next.ServeHTTP(w, r)
 			}
@@ -108,7 +253,8 @@ type LogAndPanicFormatter interface {
 }
 
 // LogEntry records the final log when a request completes.
-// See defaultLogEntry for an example implementation.
+// See defaultLogEntry for an example implementation and ResponseLogEntry to
+// receive all response data.
 type LogEntry interface {
 	Write(status, bytes int, elapsed time.Duration)
 	WithLogger(logger LoggerInterface) LogEntry
@@ -158,23 +304,111 @@ type LoggerInterface interface {
 
 // DefaultLogAndPanicFormatter is a simple logger that implements a LogFormatter.
 type DefaultLogAndPanicFormatter struct {
+	LogFormatterConfig
 	Logger, PanicLogger LoggerInterface
 	NoColor             bool
-	IgnoreExtensions    Extensions
 	TruncateUri         int
 	NoColorTtyCheck     bool
+	// LatencyBands is the elapsed time colors. Default is DefaultLatencyBands.
+	LatencyBands []LatencyBand
+	// StatusColors overrides the color of the status codes.
+	StatusColors map[int][]byte
+	// SlowThreshold flags the requests with elapsed time greater or equals to
+	// it as SLOW and writes them to SlowLogger, or to PanicLogger if
+	// SlowLogger is nil. Zero disables.
+	SlowThreshold time.Duration
+	SlowLogger    LoggerInterface
+	// LogRoute writes the chi route pattern and LogURLParams the URL params.
+	LogRoute, LogURLParams bool
+}
+
+// LatencyBand is the color of the elapsed times lower than Max. Zero Max
+// matches any elapsed time. Use Color to create colors.
+type LatencyBand struct {
+	Max   time.Duration
+	Color []byte
+}
+
+// DefaultLatencyBands is the default elapsed time colors.
+var DefaultLatencyBands = []LatencyBand{
+	{500 * time.Millisecond, nGreen},
+	{5 * time.Second, nYellow},
+	{0, nRed},
+}
+
+// statusColor returns the status color. l may be nil.
+func (l *DefaultLogAndPanicFormatter) statusColor(status int) []byte {
+	if l != nil {
+		if c, ok := l.StatusColors[status]; ok {
+			return c
+		}
+	}
+	switch {
+	case status < 200:
+		return bBlue
+	case status < 300:
+		return bGreen
+	case status < 400:
+		return bCyan
+	case status < 500:
+		return bYellow
+	}
+	return bRed
+}
+
+// latencyColor returns the elapsed time color. l may be nil.
+func (l *DefaultLogAndPanicFormatter) latencyColor(elapsed time.Duration) []byte {
+	bands := DefaultLatencyBands
+	if l != nil && len(l.LatencyBands) > 0 {
+		bands = l.LatencyBands
+	}
+	for _, band := range bands {
+		if band.Max == 0 || elapsed < band.Max {
+			return band.Color
+		}
+	}
+	return nRed
+}
+
+// isSlow reports whether the elapsed time reaches the SlowThreshold.
+func (l *DefaultLogAndPanicFormatter) isSlow(elapsed time.Duration) bool {
+	return l.SlowThreshold > 0 && elapsed >= l.SlowThreshold
 }
 
-func (l *DefaultLogAndPanicFormatter) Accept(r *http.Request) bool {
-	if l.IgnoreExtensions != nil {
+func (l *DefaultLogAndPanicFormatter) slowLogger() LoggerInterface {
+	if l.SlowLogger != nil {
+		return l.SlowLogger
+	}
+	if l.PanicLogger != nil {
+		return l.PanicLogger
+	}
+	return l.Logger
+}
+
+// acceptExtension reports whether the request path extension is not ignored.
+func acceptExtension(ignore Extensions, r *http.Request) bool {
+	if ignore != nil {
 		if ext := path.Ext(r.URL.Path); ext != "" {
-			return !l.IgnoreExtensions[ext[1:]]
+			return !ignore[ext[1:]]
 		}
 	}
 	return true
 }
 
+// requestScheme returns the request URL scheme.
+func requestScheme(r *http.Request) string {
+	if r.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// LoggerPrintRequestMessage prints the request message with DefaultRedactor.
 func LoggerPrintRequestMessage(cW func(w io.Writer, useColor bool, color []byte, s string, args ...interface{}), useColor bool, maxUriLen int, w io.Writer, r *http.Request) {
+	loggerPrintRequestMessage(cW, useColor, maxUriLen, DefaultRedactor, w, r)
+}
+
+func loggerPrintRequestMessage(cW ColorWriterFunc, useColor bool, maxUriLen int, redactor *Redactor, w io.Writer, r *http.Request) {
 	reqID := middleware.GetReqID(r.Context())
 	host, _, _ := net.SplitHostPort(helpers.ReadUserIP(r))
 	if host != "" {
@@ -183,49 +417,45 @@ func LoggerPrintRequestMessage(cW func(w io.Writer, useColor bool, color []byte,
 	if reqID != "" {
 		cW(w, useColor, nYellow, " [%s]", reqID)
 	}
+	if tc := GetTraceContext(r.Context()); tc != nil {
+		cW(w, useColor, nBlue, " trace=%s span=%s", tc.TraceID, tc.SpanID)
+	}
 	if host != "" {
 		w.Write([]byte("» "))
 	}
 	cW(w, useColor, nCyan, "\"")
 	cW(w, useColor, bMagenta, "%s ", r.Method)
 
-	scheme := "http"
-	if r.TLS != nil {
-		scheme = "https"
-	}
+	scheme := requestScheme(r)
 
-	uri := r.RequestURI
+	uri := redactor.URI(r.RequestURI)
 	if maxUriLen > 0 && len(uri) > maxUriLen+4 {
 		uri = uri[0:maxUriLen] + " ..."
 	}
-	cW(w, useColor, nCyan, "%s://%s%s %s\" ", scheme, r.Host, r.RequestURI, r.Proto)
+	cW(w, useColor, nCyan, "%s://%s%s %s\" ", scheme, r.Host, uri, r.Proto)
 }
 
 func LoggerPrintResponseMessage(cW func(w io.Writer, useColor bool, color []byte, s string, args ...interface{}), useColor bool, w io.Writer, status, bytes int, elapsed time.Duration) {
+	loggerPrintResponseMessage(cW, useColor, nil, w, &ResponseInfo{Status: status, Bytes: bytes, Elapsed: elapsed})
+}
+
+func loggerPrintResponseMessage(cW ColorWriterFunc, useColor bool, l *DefaultLogAndPanicFormatter, w io.Writer, info *ResponseInfo) {
+	status, bytes, elapsed := info.Status, info.Bytes, info.Elapsed
 	w.Write([]byte("→ \""))
 
 	switch {
-	case status < 200:
-		cW(w, useColor, bBlue, "%03d", status)
-	case status < 300:
-		cW(w, useColor, bGreen, "%03d", status)
-	case status < 400:
-		cW(w, useColor, bCyan, "%03d", status)
-	case status < 500:
-		cW(w, useColor, bYellow, "%03d", status)
+	case info.PseudoStatus == PseudoStatusImplicit200:
+		cW(w, useColor, bGreen, "%s", info.PseudoStatus)
+	case info.PseudoStatus == PseudoStatusPanicked:
+		cW(w, useColor, bRed, "%s", info.PseudoStatus)
+	case info.PseudoStatus != "":
+		cW(w, useColor, bYellow, "%s", info.PseudoStatus)
 	default:
-		cW(w, useColor, bRed, "%03d", status)
+		cW(w, useColor, l.statusColor(status), "%03d", status)
 	}
 
 	cW(w, useColor, bBlue, " %dB ", bytes)
-
-	if elapsed < 500*time.Millisecond {
-		cW(w, useColor, nGreen, "%s", elapsed)
-	} else if elapsed < 5*time.Second {
-		cW(w, useColor, nYellow, "%s", elapsed)
-	} else {
-		cW(w, useColor, nRed, "%s", elapsed)
-	}
+	cW(w, useColor, l.latencyColor(elapsed), "%s", elapsed)
 
 	w.Write([]byte("\""))
 }
@@ -240,6 +470,7 @@ func (l *DefaultLogAndPanicFormatter) NewLogEntry(r *http.Request) LogEntry {
 			request:                     r,
 			buf:                         &bytes.Buffer{},
 			useColor:                    useColor,
+			fields:                      &LogFields{},
 		},
 	}
 
@@ -248,7 +479,7 @@ func (l *DefaultLogAndPanicFormatter) NewLogEntry(r *http.Request) LogEntry {
 		cW = ColorWrite
 	}
 
-	LoggerPrintRequestMessage(cW, useColor, l.TruncateUri, entry.buf, r)
+	loggerPrintRequestMessage(cW, useColor, l.TruncateUri, l.redactor(), entry.buf, r)
 
 	return entry
 }
@@ -271,7 +502,7 @@ func (l *DefaultLogAndPanicFormatter) NewPanicEntry(r *http.Request) PanicEntry
 		cW = ColorWrite
 	}
 
-	LoggerPrintRequestMessage(cW, useColor, l.TruncateUri, entry.buf, r)
+	loggerPrintRequestMessage(cW, useColor, l.TruncateUri, l.redactor(), entry.buf, r)
 	return entry
 }
 
@@ -281,6 +512,7 @@ type baseLogEntry struct {
 	request                   *http.Request
 	buf                       *bytes.Buffer
 	useColor, fullUrl, panics bool
+	fields                    *LogFields
 }
 
 func (l *baseLogEntry) ColorWriter() ColorWriterFunc {
@@ -296,8 +528,46 @@ type defaultLogEntry struct {
 }
 
 func (l *defaultLogEntry) Write(status, bytes int, elapsed time.Duration) {
-	LoggerPrintResponseMessage(l.ColorWriter(), l.useColor, l.buf, status, bytes, elapsed)
-	l.Logger.Print(l.buf.String())
+	l.WriteResponse(&ResponseInfo{Status: status, Bytes: bytes, Elapsed: elapsed})
+}
+
+func (l *defaultLogEntry) WriteResponse(info *ResponseInfo) {
+	loggerPrintResponseMessage(l.ColorWriter(), l.useColor, l.DefaultLogAndPanicFormatter, l.buf, info)
+	lgr := l.Logger
+	if l.isSlow(info.Elapsed) {
+		l.ColorWriter()(l.buf, l.useColor, bRed, " SLOW")
+		lgr = l.slowLogger()
+	}
+	if info.ClientClosed && info.PseudoStatus != PseudoStatusClientClosed {
+		l.ColorWriter()(l.buf, l.useColor, bYellow, " client-closed")
+	}
+	if info.WriteErrors > 0 {
+		l.ColorWriter()(l.buf, l.useColor, nRed, " write-errors=%d", info.WriteErrors)
+	}
+	writeLogFields(l.buf, routeLogFields(info, l.LogRoute, l.LogURLParams))
+	writeLogFields(l.buf, l.fields.Fields())
+	redactor := l.redactor()
+	writeCapturedBody(l.buf, "request body", info.RequestBody.redacted(redactor))
+	writeCapturedBody(l.buf, "response body", info.ResponseBody.redacted(redactor))
+	lgr.Print(l.buf.String())
+}
+
+// WriteStart writes the request message followed by "started".
+func (l *defaultLogEntry) WriteStart() {
+	l.Logger.Print(l.buf.String() + "→ started")
+}
+
+// WriteRunning writes the request message followed by "still running".
+func (l *defaultLogEntry) WriteRunning(elapsed time.Duration) {
+	var buf bytes.Buffer
+	buf.Write(l.buf.Bytes())
+	l.ColorWriter()(&buf, l.useColor, bYellow, "→ still running %s", elapsed)
+	l.Logger.Print(buf.String())
+}
+
+// SetField sets the key/value written after the response message.
+func (l *defaultLogEntry) SetField(key string, value interface{}) {
+	l.fields.Set(key, value)
 }
 
 type defaultPanicEntry struct {
@@ -307,21 +577,20 @@ type defaultPanicEntry struct {
 func (l *defaultPanicEntry) Write(v interface{}, stackb []byte) {
 	panicEntry := l.DefaultLogAndPanicFormatter.NewPanicEntry(l.request).(*defaultPanicEntry)
 	panicEntry.fullUrl = true
-	l.ColorWriter()(panicEntry.buf, l.useColor, bRed, "panic: %+v", v)
+	l.ColorWriter()(panicEntry.buf, l.useColor, bRed, "panic: %s", l.redactor().String(fmt.Sprintf("%+v", v)))
 	lgr := l.PanicLogger
 	if lgr == nil {
 		lgr = l.Logger
 	}
 	var out bytes.Buffer
-	c, err := stack.ParseDump(bytes.NewReader(stackb), &out, false)
+	buckets, err := ParseStack(stackb)
 	if err != nil {
-		lgr.Print(string(stackb))
+		lgr.Print(l.redactor().String(string(stackb)))
 	} else {
-		buckets := stack.Aggregate(c.Goroutines, stack.AnyValue)
 		if err := StackWriteToConsole(&out, &defaultStackPalette, buckets, false, true, nil, nil); err == nil {
 			panicEntry.buf.Write(out.Bytes())
 		} else {
-			panicEntry.buf.Write(stackb)
+			panicEntry.buf.WriteString(l.redactor().String(string(stackb)))
 		}
 	}
 	lgr.Print(panicEntry.buf.String())
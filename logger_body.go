@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// DefaultBodyCaptureMaxBytes is the default max captured bytes of each body.
+const DefaultBodyCaptureMaxBytes = 4096
+
+// DefaultBodyCaptureContentTypes is the default content types captured.
+var DefaultBodyCaptureContentTypes = []string{
+	"application/json",
+	"application/x-www-form-urlencoded",
+	"text/",
+}
+
+// BodyCaptureOpts configures the request and response body capture of
+// RequestLogger. It is only for debug: the bodies are kept in memory until the
+// request completes.
+type BodyCaptureOpts struct {
+	// MaxBytes is the max captured bytes of each body. Bytes after it are
+	// proxied but not captured. Default is DefaultBodyCaptureMaxBytes.
+	MaxBytes int
+	// ContentTypes is the media types to capture. Values ending with "/" are
+	// matched as prefix. Default is DefaultBodyCaptureContentTypes.
+	ContentTypes []string
+	// RedactFields is the JSON fields or form keys whose values are masked.
+	// JSON object and array values are masked as a whole.
+	RedactFields []string
+	// Mask replaces the redacted values. Default is "***".
+	Mask string
+}
+
+// CapturedBody is a request or response body captured by RequestLogger.
+type CapturedBody struct {
+	ContentType string
+	Data        []byte
+	// Size is the total body size, including not captured bytes.
+	Size      int
+	Truncated bool
+}
+
+// redacted returns the body with the Redactor Patterns masked. The body may
+// be nil.
+func (body *CapturedBody) redacted(redactor *Redactor) *CapturedBody {
+	if body == nil {
+		return nil
+	}
+	c := *body
+	c.Data = []byte(redactor.String(string(body.Data)))
+	return &c
+}
+
+// writeCapturedBody writes the body after a header line.
+func writeCapturedBody(w io.Writer, name string, body *CapturedBody) {
+	if body == nil {
+		return
+	}
+	fmt.Fprintf(w, "\n--- %s: %s %dB", name, body.ContentType, body.Size)
+	if body.Truncated {
+		fmt.Fprintf(w, " (truncated to %dB)", len(body.Data))
+	}
+	w.Write([]byte{'\n'})
+	w.Write(body.Data)
+}
+
+// bodyCapturer is the compiled BodyCaptureOpts.
+type bodyCapturer struct {
+	maxBytes     int
+	contentTypes []string
+	redactFields map[string]bool
+	redactJSON   *regexp.Regexp
+	mask         string
+	jsonMask     []byte
+}
+
+func newBodyCapturer(opts *BodyCaptureOpts) *bodyCapturer {
+	c := &bodyCapturer{
+		maxBytes:     opts.MaxBytes,
+		contentTypes: opts.ContentTypes,
+		mask:         opts.Mask,
+	}
+	if c.maxBytes <= 0 {
+		c.maxBytes = DefaultBodyCaptureMaxBytes
+	}
+	if len(c.contentTypes) == 0 {
+		c.contentTypes = DefaultBodyCaptureContentTypes
+	}
+	if c.mask == "" {
+		c.mask = "***"
+	}
+	c.jsonMask, _ = json.Marshal(c.mask)
+	if len(opts.RedactFields) > 0 {
+		c.redactFields = map[string]bool{}
+		quoted := make([]string, len(opts.RedactFields))
+		for i, name := range opts.RedactFields {
+			c.redactFields[name] = true
+			quoted[i] = regexp.QuoteMeta(name)
+		}
+		c.redactJSON = regexp.MustCompile(`"(?:` + strings.Join(quoted, "|") + `)"\s*:\s*`)
+	}
+	return c
+}
+
+// accept reports whether the content type is captured.
+func (c *bodyCapturer) accept(contentType string) bool {
+	if contentType == "" {
+		return false
+	}
+	if mt, _, err := mime.ParseMediaType(contentType); err == nil {
+		contentType = mt
+	}
+	for _, ct := range c.contentTypes {
+		if strings.HasSuffix(ct, "/") {
+			if strings.HasPrefix(contentType, ct) {
+				return true
+			}
+		} else if contentType == ct {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *bodyCapturer) newBuffer(contentType string) *bodyBuffer {
+	return &bodyBuffer{capturer: c, contentType: contentType}
+}
+
+// captureRequest replaces the request body by a capturing reader, if the
+// request content type is accepted.
+func (c *bodyCapturer) captureRequest(r *http.Request) *bodyBuffer {
+	if r.Body == nil || r.Body == http.NoBody {
+		return nil
+	}
+	ct := r.Header.Get("Content-Type")
+	if !c.accept(ct) {
+		return nil
+	}
+	buf := c.newBuffer(ct)
+	r.Body = &captureReadCloser{r.Body, buf}
+	return buf
+}
+
+// redact masks the redacted fields of the body data.
+func (c *bodyCapturer) redact(contentType string, data []byte) []byte {
+	if c.redactFields == nil || len(data) == 0 {
+		return data
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mt == "application/x-www-form-urlencoded":
+		return []byte(redactForm(string(data), c.redactFields, c.mask))
+	case mt == "application/json" || strings.HasSuffix(mt, "+json"):
+		return c.redactJSONData(data)
+	}
+	return data
+}
+
+// redactJSONData masks the values of the redacted JSON fields. The data may
+// be truncated, so a value not terminated is masked to the end.
+func (c *bodyCapturer) redactJSONData(data []byte) []byte {
+	var out []byte
+	pos := 0
+	for pos < len(data) {
+		loc := c.redactJSON.FindIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		start := pos + loc[1]
+		end := jsonValueEnd(data, start)
+		if end == start {
+			// empty value
+			out = append(out, data[pos:start]...)
+			pos = start
+			continue
+		}
+		out = append(append(out, data[pos:start]...), c.jsonMask...)
+		pos = end
+	}
+	if out == nil {
+		return data
+	}
+	return append(out, data[pos:]...)
+}
+
+// jsonValueEnd returns the end position of the JSON value starting at i.
+func jsonValueEnd(data []byte, i int) int {
+	if i >= len(data) {
+		return i
+	}
+	switch data[i] {
+	case '"':
+		return jsonStringEnd(data, i)
+	case '{', '[':
+		depth := 0
+		for i < len(data) {
+			switch data[i] {
+			case '"':
+				i = jsonStringEnd(data, i)
+				continue
+			case '{', '[':
+				depth++
+			case '}', ']':
+				if depth--; depth == 0 {
+					return i + 1
+				}
+			}
+			i++
+		}
+		return i
+	}
+	for i < len(data) && !strings.ContainsRune(",}] \t\r\n", rune(data[i])) {
+		i++
+	}
+	return i
+}
+
+// jsonStringEnd returns the end position of the JSON string starting at i.
+func jsonStringEnd(data []byte, i int) int {
+	for i++; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(data)
+}
+
+// redactForm masks the values of the keys of the URL encoded form.
+func redactForm(form string, keys map[string]bool, mask string) string {
+	pairs := strings.Split(form, "&")
+	for i, pair := range pairs {
+		rawKey := pair
+		if eq := strings.IndexByte(pair, '='); eq >= 0 {
+			rawKey = pair[:eq]
+		}
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		if keys[key] {
+			pairs[i] = rawKey + "=" + mask
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// bodyBuffer is a bounded body buffer. Writes never fail, so the capture
+// does not break the streaming when the limit is exceeded.
+type bodyBuffer struct {
+	capturer    *bodyCapturer
+	contentType string
+	data        []byte
+	size        int
+	truncated   bool
+}
+
+func (b *bodyBuffer) Write(p []byte) (int, error) {
+	b.size += len(p)
+	if room := b.capturer.maxBytes - len(b.data); room < len(p) {
+		b.truncated = true
+		b.data = append(b.data, p[:room]...)
+	} else {
+		b.data = append(b.data, p...)
+	}
+	return len(p), nil
+}
+
+// Body returns the captured body with the redacted fields masked.
+func (b *bodyBuffer) Body() *CapturedBody {
+	if b == nil {
+		return nil
+	}
+	return &CapturedBody{
+		ContentType: b.contentType,
+		Data:        b.capturer.redact(b.contentType, b.data),
+		Size:        b.size,
+		Truncated:   b.truncated,
+	}
+}
+
+type captureReadCloser struct {
+	io.ReadCloser
+	buf *bodyBuffer
+}
+
+func (r *captureReadCloser) Read(p []byte) (n int, err error) {
+	n, err = r.ReadCloser.Read(p)
+	r.buf.Write(p[:n])
+	return
+}
@@ -0,0 +1,134 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestBodyCapturer_Redact(t *testing.T) {
+	c := newBodyCapturer(&BodyCaptureOpts{RedactFields: []string{"password", "card"}})
+	tests := []struct {
+		contentType, data, want string
+	}{
+		{"application/json", `{"user":"a","password":"s\"x"}`, `{"user":"a","password":"***"}`},
+		{"application/json", `{"password": 123, "n": 1}`, `{"password": "***", "n": 1}`},
+		{"application/json", `{"password":{"old":"a","new":["b}"]},"n":1}`, `{"password":"***","n":1}`},
+		{"application/json", `[{"card":["1","2"]},{"card":null}]`, `[{"card":"***"},{"card":"***"}]`},
+		{"application/vnd.api+json", `{"password":{"old":"tru`, `{"password":"***"`},
+		{"application/x-www-form-urlencoded", "user=a&password=s&card=1", "user=a&password=***&card=***"},
+		{"text/plain", "password=s", "password=s"},
+	}
+	for _, tt := range tests {
+		if got := string(c.redact(tt.contentType, []byte(tt.data))); got != tt.want {
+			t.Errorf("%s %s: got %s, want %s", tt.contentType, tt.data, got, tt.want)
+		}
+	}
+}
+
+func TestBodyCapturer_Accept(t *testing.T) {
+	c := newBodyCapturer(&BodyCaptureOpts{})
+	for ct, want := range map[string]bool{
+		"application/json; charset=utf-8":   true,
+		"text/html":                         true,
+		"application/x-www-form-urlencoded": true,
+		"image/png":                         false,
+		"application/octet-stream":          false,
+		"":                                  false,
+	} {
+		if got := c.accept(ct); got != want {
+			t.Errorf("%q: got %v, want %v", ct, got, want)
+		}
+	}
+}
+
+func TestRequestLogger_BodyCapture(t *testing.T) {
+	f := &recordLogFormatter{}
+	opts := &RequestLoggerOpts{BodyCapture: &BodyCaptureOpts{MaxBytes: 8}}
+	RequestLogger(f, opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("0123456789"))
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader("abc")))
+	info := f.last(t)
+	if b := info.RequestBody; b != nil {
+		t.Errorf("request without content type captured: %+v", b)
+	}
+	if b := info.ResponseBody; b == nil || string(b.Data) != "01234567" || b.Size != 10 || !b.Truncated {
+		t.Errorf("response body: got %+v", b)
+	}
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"a":1}`))
+	r.Header.Set("Content-Type", "application/json")
+	RequestLogger(f, opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	info = f.last(t)
+	if b := info.RequestBody; b == nil || string(b.Data) != `{"a":1}` || b.Size != 7 || b.Truncated {
+		t.Errorf("request body: got %+v", b)
+	}
+	if b := info.ResponseBody; b != nil {
+		t.Errorf("image response captured: %+v", b)
+	}
+}
+
+func TestRequestLogger_BodyCaptureReadFrom(t *testing.T) {
+	f := &recordLogFormatter{}
+	body := strings.Repeat("x", 100000)
+	ts := httptest.NewServer(RequestLogger(f, &RequestLoggerOpts{BodyCapture: &BodyCaptureOpts{}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if _, ok := w.(io.ReaderFrom); !ok {
+			t.Error("writer is not io.ReaderFrom")
+		}
+		io.Copy(w, struct{ io.Reader }{strings.NewReader(body)})
+	})))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if string(got) != body {
+		t.Errorf("response: got %d bytes", len(got))
+	}
+	info := f.last(t)
+	if b := info.ResponseBody; b == nil || len(b.Data) != DefaultBodyCaptureMaxBytes || b.Size != len(body) || !b.Truncated {
+		t.Errorf("response body: got %+v", b)
+	}
+	if info.Bytes != len(body) {
+		t.Errorf("bytes: got %d", info.Bytes)
+	}
+}
+
+func TestRequestLogger_BodyCaptureRedactor(t *testing.T) {
+	var out bytes.Buffer
+	defaultFormatter := NewDefaultRequestLogFormatter(&out, &out, "")
+	defaultFormatter.NoColor = true
+	formatters := map[string]LogFormatter{
+		"default": defaultFormatter,
+		"json":    NewJSONLogFormatter(&out, &out),
+		"slog":    NewSlogLogFormatter(slog.New(slog.NewJSONHandler(&out, nil))),
+	}
+	for name, f := range formatters {
+		out.Reset()
+		r := httptest.NewRequest("POST", "/", strings.NewReader(`{"auth":"Bearer abc.def"}`))
+		r.Header.Set("Content-Type", "application/json")
+		RequestLogger(f, &RequestLoggerOpts{BodyCapture: &BodyCaptureOpts{}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ioutil.ReadAll(r.Body)
+			w.Header().Set("Content-Type", "text/plain")
+			w.Write([]byte("token eyJhbGciOi.eyJzdWIiOi.c2lnbmF0dXJl"))
+		})).ServeHTTP(httptest.NewRecorder(), r)
+		if got := out.String(); strings.Contains(got, "abc.def") || strings.Contains(got, "eyJ") || strings.Count(got, "***") != 2 {
+			t.Errorf("%s: bodies not redacted: %s", name, got)
+		}
+	}
+}
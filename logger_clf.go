@@ -0,0 +1,143 @@
+package middleware
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CommonLogTimeFormat is the timestamp layout of the Common Log Format.
+const CommonLogTimeFormat = "02/Jan/2006:15:04:05 -0700"
+
+// CommonLogFormatter is a LogFormatter that writes Apache/NCSA Common Log
+// Format lines:
+//
+//	host ident user [time] "request" status bytes
+//
+// If Combined is set, writes the Combined Log Format, that appends the
+// "referer" and "user-agent" to the line.
+//
+// The requests without status (hijacked or panicked before writing) are
+// logged with status "-".
+//
+// The line format is fixed, so the entries do not carry the log fields (see
+// SetLogField). Use a TemplateLogFormatter with the %F directive instead.
+type CommonLogFormatter struct {
+	LogFormatterConfig
+	Logger   LoggerInterface
+	Combined bool
+}
+
+// NewCommonLogFormatter create Common Log Format request logger.
+func NewCommonLogFormatter(out io.Writer, ignore ...Extensions) *CommonLogFormatter {
+	return &CommonLogFormatter{
+		LogFormatterConfig: newLogFormatterConfig(ignore...),
+		Logger:             log.New(out, "", 0),
+	}
+}
+
+// NewCombinedLogFormatter create Combined Log Format request logger.
+func NewCombinedLogFormatter(out io.Writer, ignore ...Extensions) *CommonLogFormatter {
+	f := NewCommonLogFormatter(out, ignore...)
+	f.Combined = true
+	return f
+}
+
+// NewLogEntry creates a new LogEntry for the request.
+func (l *CommonLogFormatter) NewLogEntry(r *http.Request) LogEntry {
+	return &commonLogEntry{l.Logger, r, time.Now(), l.Combined, l.redactor()}
+}
+
+type commonLogEntry struct {
+	logger   LoggerInterface
+	request  *http.Request
+	start    time.Time
+	combined bool
+	redactor *Redactor
+}
+
+func (l *commonLogEntry) Write(status, bytes int, elapsed time.Duration) {
+	l.logger.Print(string(appendCommonLog(nil, l.redactor, l.request, l.start, status, bytes, l.combined)))
+}
+
+func (l *commonLogEntry) WriteResponse(info *ResponseInfo) {
+	l.Write(info.Status, info.Bytes, info.Elapsed)
+}
+
+func (l commonLogEntry) WithLogger(logger LoggerInterface) LogEntry {
+	l.logger = logger
+	return &l
+}
+
+// appendCommonLog appends the Common (or Combined) Log Format line to buf.
+func appendCommonLog(buf []byte, redactor *Redactor, r *http.Request, start time.Time, status, size int, combined bool) []byte {
+	buf = appendCommonLogValue(buf, GetRealIP(r))
+	buf = append(buf, " - "...)
+	buf = appendCommonLogValue(buf, requestUsername(r))
+	buf = append(buf, " ["...)
+	buf = start.AppendFormat(buf, CommonLogTimeFormat)
+	buf = append(buf, "] \""...)
+	buf = appendCommonLogEscaped(buf, r.Method)
+	buf = append(buf, ' ')
+	buf = appendCommonLogEscaped(buf, redactor.URI(r.RequestURI))
+	buf = append(buf, ' ')
+	buf = appendCommonLogEscaped(buf, r.Proto)
+	buf = append(buf, "\" "...)
+	if status > 0 {
+		buf = strconv.AppendInt(buf, int64(status), 10)
+	} else {
+		buf = append(buf, '-')
+	}
+	buf = append(buf, ' ')
+	if size > 0 {
+		buf = strconv.AppendInt(buf, int64(size), 10)
+	} else {
+		buf = append(buf, '-')
+	}
+	if combined {
+		buf = append(buf, " \""...)
+		buf = appendCommonLogValue(buf, redactor.Header("Referer", r.Referer()))
+		buf = append(buf, "\" \""...)
+		buf = appendCommonLogValue(buf, redactor.Header("User-Agent", r.UserAgent()))
+		buf = append(buf, '"')
+	}
+	return buf
+}
+
+// requestUsername returns the URL or basic auth user name.
+func requestUsername(r *http.Request) string {
+	if r.URL != nil && r.URL.User != nil {
+		if name := r.URL.User.Username(); name != "" {
+			return name
+		}
+	}
+	name, _, _ := r.BasicAuth()
+	return name
+}
+
+// appendCommonLogValue appends the escaped value or "-" if empty.
+func appendCommonLogValue(buf []byte, s string) []byte {
+	if s == "" {
+		return append(buf, '-')
+	}
+	return appendCommonLogEscaped(buf, s)
+}
+
+// appendCommonLogEscaped appends s escaping quotes, backslashes and non
+// printable characters as Apache does.
+func appendCommonLogEscaped(buf []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '"' || c == '\\':
+			buf = append(buf, '\\', c)
+		case c < 0x20 || c >= 0x7f:
+			buf = append(buf, '\\', 'x', hex[c>>4], hex[c&0xf])
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return buf
+}
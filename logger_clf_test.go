@@ -0,0 +1,38 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+func TestCommonLogFormatter(t *testing.T) {
+	tests := []struct {
+		name     string
+		combined bool
+		want     string
+	}{
+		{"common", false, `^10\.0\.0\.1 - bob \[\d{2}/\w{3}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\] "GET /a\?q=\\"x\\" HTTP/1\.1" 200 5\n$`},
+		{"combined", true, `^10\.0\.0\.1 - bob \[[^]]+\] "GET /a\?q=\\"x\\" HTTP/1\.1" 200 5 "-" "agent\\x01"\n$`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			f := NewCommonLogFormatter(&out)
+			f.Combined = tt.combined
+			h := RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("hello"))
+			}))
+			r := httptest.NewRequest("GET", `/a?q="x"`, nil)
+			r.Header.Set("X-Forwarded-For", "10.0.0.1")
+			r.Header.Set("User-Agent", "agent\x01")
+			r.SetBasicAuth("bob", "secret")
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if !regexp.MustCompile(tt.want).MatchString(out.String()) {
+				t.Errorf("got %q, want match %s", out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// LogField is a key/value added to the request log entry.
+type LogField struct {
+	Key   string
+	Value interface{}
+}
+
+// LogFields is a list of LogField safe for concurrent use.
+type LogFields struct {
+	mu     sync.Mutex
+	fields []LogField
+}
+
+// Set sets the field value, replacing the previous value of the key.
+func (f *LogFields) Set(key string, value interface{}) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for i := range f.fields {
+		if f.fields[i].Key == key {
+			f.fields[i].Value = value
+			return
+		}
+	}
+	f.fields = append(f.fields, LogField{key, value})
+}
+
+// Fields returns a copy of the fields in insertion order.
+func (f *LogFields) Fields() []LogField {
+	if f == nil {
+		return nil
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]LogField(nil), f.fields...)
+}
+
+// Map returns the fields as map, or nil if there is no fields.
+func (f *LogFields) Map() map[string]interface{} {
+	fields := f.Fields()
+	if len(fields) == 0 {
+		return nil
+	}
+	m := make(map[string]interface{}, len(fields))
+	for _, field := range fields {
+		m[field.Key] = field.Value
+	}
+	return m
+}
+
+// FieldsLogEntry is a LogEntry that accepts key/values to be written on the
+// final log line. All LogEntry of this package implements it, except the
+// CommonLogFormatter ones, whose line format is fixed.
+type FieldsLogEntry interface {
+	LogEntry
+	SetField(key string, value interface{})
+}
+
+// SetLogField sets the key/value on the in-context LogEntry of the request.
+// Returns false if there is no entry or if it does not accept fields.
+func SetLogField(r *http.Request, key string, value interface{}) bool {
+	if entry, ok := GetLogEntry(r).(FieldsLogEntry); ok {
+		entry.SetField(key, value)
+		return true
+	}
+	return false
+}
+
+// writeLogFields writes the fields as ` key=value` pairs, quoting the keys
+// and values when needed.
+func writeLogFields(w io.Writer, fields []LogField) {
+	for _, field := range fields {
+		io.WriteString(w, " "+logFieldText(field.Key)+"="+logFieldText(fmt.Sprint(field.Value)))
+	}
+}
+
+// logFieldText returns s quoted if it is empty or has spaces, quotes, equal
+// signs or non printable characters, like the ANSI escapes.
+func logFieldText(s string) string {
+	if s == "" || strings.IndexFunc(s, func(r rune) bool {
+		return r == ' ' || r == '"' || r == '=' || !unicode.IsPrint(r)
+	}) >= 0 {
+		return strconv.Quote(s)
+	}
+	return s
+}
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestSetLogField_Default(t *testing.T) {
+	var out bytes.Buffer
+	f := NewDefaultRequestLogFormatter(&out, &out, "")
+	f.NoColorTtyCheck = true
+	RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !SetLogField(r, "user", "bob") {
+			t.Error("field not set")
+		}
+		SetLogField(r, "msg", "a b")
+		SetLogField(r, "\x1b[31mkey", "x\x1b[0m")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	line := out.String()
+	if want := ` user=bob msg="a b" "\x1b[31mkey"="x\x1b[0m"`; !strings.Contains(line, want) {
+		t.Errorf("%q not found in %q", want, line)
+	}
+	if strings.Contains(line, "\x1b[31mkey") || strings.Contains(line, "x\x1b[0m") {
+		t.Errorf("control characters not escaped in %q", line)
+	}
+}
+
+func TestSetLogField_JSON(t *testing.T) {
+	var out bytes.Buffer
+	RequestLogger(NewJSONLogFormatter(&out, &out))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetLogField(r, "user", "bob")
+		SetLogField(r, "n", 1)
+		SetLogField(r, "user", "alice")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var rec JSONLogRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if len(rec.Fields) != 2 || rec.Fields["user"] != "alice" || rec.Fields["n"] != float64(1) {
+		t.Errorf("got fields %v", rec.Fields)
+	}
+}
+
+func TestSetLogField_Concurrent(t *testing.T) {
+	const n = 50
+	var out bytes.Buffer
+	RequestLogger(NewJSONLogFormatter(&out, &out))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				SetLogField(r, fmt.Sprintf("k%d", i), i)
+				SetLogField(r, "last", i)
+			}(i)
+		}
+		wg.Wait()
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var rec JSONLogRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if len(rec.Fields) != n+1 {
+		t.Errorf("got %d fields, want %d", len(rec.Fields), n+1)
+	}
+}
+
+func TestWriteLogFields(t *testing.T) {
+	var buf bytes.Buffer
+	writeLogFields(&buf, []LogField{{"a", "b"}, {"", ""}, {"k=v", "x\ny"}, {"tab", "\t"}})
+	if want := ` a=b ""="" "k=v"="x\ny" tab="\t"`; buf.String() != want {
+		t.Errorf("got %q, want %q", buf.String(), want)
+	}
+}
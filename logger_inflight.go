@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// ProgressLogEntry is a LogEntry that writes lines while the request is in
+// progress. See RequestLoggerOpts.LogStart and StillRunningAfter.
+type ProgressLogEntry interface {
+	LogEntry
+	// WriteStart writes the request started line.
+	WriteStart()
+	// WriteRunning writes the request still running line.
+	WriteRunning(elapsed time.Duration)
+}
+
+// InFlightRequest is a request in progress.
+type InFlightRequest struct {
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	RemoteIP  string    `json:"remote_ip"`
+	RequestID string    `json:"request_id,omitempty"`
+	Start     time.Time `json:"start"`
+}
+
+// Elapsed returns the time since the request started.
+func (r *InFlightRequest) Elapsed() time.Duration {
+	return time.Since(r.Start)
+}
+
+// InFlightRegistry registers the requests in progress. Set it to
+// RequestLoggerOpts.InFlight. It is also the debug http.Handler that lists
+// the requests, as JSON if requested by the Accept header or the "json"
+// query param, otherwise as text.
+type InFlightRegistry struct {
+	// Redactor masks the sensitive data of the URI. Default is DefaultRedactor.
+	Redactor *Redactor
+
+	mu       sync.Mutex
+	seq      uint64
+	requests map[uint64]*InFlightRequest
+}
+
+// NewInFlightRegistry creates a new InFlightRegistry.
+func NewInFlightRegistry() *InFlightRegistry {
+	return &InFlightRegistry{requests: map[uint64]*InFlightRequest{}}
+}
+
+// Add registers the request and returns the func to remove it.
+func (reg *InFlightRegistry) Add(r *http.Request, start time.Time) (remove func()) {
+	req := &InFlightRequest{
+		Method:    r.Method,
+		URI:       redactorOf(reg.Redactor).URI(r.RequestURI),
+		RemoteIP:  GetRealIP(r),
+		RequestID: middleware.GetReqID(r.Context()),
+		Start:     start,
+	}
+	reg.mu.Lock()
+	if reg.requests == nil {
+		reg.requests = map[uint64]*InFlightRequest{}
+	}
+	reg.seq++
+	id := reg.seq
+	reg.requests[id] = req
+	reg.mu.Unlock()
+	return func() {
+		reg.mu.Lock()
+		delete(reg.requests, id)
+		reg.mu.Unlock()
+	}
+}
+
+// Requests returns the requests in progress, oldest first.
+func (reg *InFlightRegistry) Requests() []InFlightRequest {
+	reg.mu.Lock()
+	requests := make([]InFlightRequest, 0, len(reg.requests))
+	for _, r := range reg.requests {
+		requests = append(requests, *r)
+	}
+	reg.mu.Unlock()
+	sort.Slice(requests, func(i, j int) bool {
+		return requests[i].Start.Before(requests[j].Start)
+	})
+	return requests
+}
+
+// Len returns the number of requests in progress.
+func (reg *InFlightRegistry) Len() int {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return len(reg.requests)
+}
+
+func (reg *InFlightRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	requests := reg.Requests()
+	if _, ok := r.URL.Query()["json"]; ok || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(requests)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "%d requests in flight\n\nELAPSED\tREMOTE IP\tREQUEST ID\tMETHOD\tURI\n", len(requests))
+	for _, req := range requests {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", req.Elapsed().Round(time.Millisecond),
+			req.RemoteIP, req.RequestID, req.Method, req.URI)
+	}
+	tw.Flush()
+}
+
+// progressWriter writes the ProgressLogEntry lines while the request is in
+// progress, and none after it is done. When hold is set, the lines are held
+// back until flush, for the requests that may not be logged.
+type progressWriter struct {
+	mu    sync.Mutex
+	entry ProgressLogEntry
+	timer *time.Timer
+	done  bool
+	hold  bool
+	held  []func()
+}
+
+func newProgressWriter(entry LogEntry, logStart bool, stillRunningAfter time.Duration, start time.Time, hold bool) *progressWriter {
+	pe, ok := entry.(ProgressLogEntry)
+	if !ok || (!logStart && stillRunningAfter <= 0) {
+		return nil
+	}
+	p := &progressWriter{entry: pe, hold: hold}
+	if logStart {
+		p.write(pe.WriteStart)
+	}
+	if stillRunningAfter > 0 {
+		p.timer = time.AfterFunc(stillRunningAfter, func() {
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if !p.done {
+				elapsed := time.Since(start)
+				p.write(func() { p.entry.WriteRunning(elapsed) })
+			}
+		})
+	}
+	return p
+}
+
+// write writes the line, or holds it back.
+func (p *progressWriter) write(line func()) {
+	if p.hold {
+		p.held = append(p.held, line)
+	} else {
+		line()
+	}
+}
+
+// flush writes the lines held back. It is called after stop, when the
+// request is logged.
+func (p *progressWriter) flush() {
+	if p == nil {
+		return
+	}
+	for _, line := range p.held {
+		line()
+	}
+	p.held = nil
+}
+
+// stop stops writing, waiting a running write to finish.
+func (p *progressWriter) stop() {
+	if p == nil {
+		return
+	}
+	if p.timer != nil {
+		p.timer.Stop()
+	}
+	p.mu.Lock()
+	p.done = true
+	p.mu.Unlock()
+}
@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+func TestInFlightRegistry(t *testing.T) {
+	reg := NewInFlightRegistry()
+	start := time.Now()
+	removeA := reg.Add(httptest.NewRequest("GET", "/a", nil), start.Add(-time.Second))
+	removeB := reg.Add(httptest.NewRequest("POST", "/b", nil), start)
+	if reg.Len() != 2 {
+		t.Fatalf("got %d requests, want 2", reg.Len())
+	}
+	if got := reg.Requests(); got[0].URI != "/a" || got[1].URI != "/b" {
+		t.Errorf("got %v, want /a and /b", got)
+	}
+
+	rec := httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/requests", nil))
+	if body := rec.Body.String(); !strings.HasPrefix(body, "2 requests in flight\n") ||
+		!strings.Contains(body, "GET     /a") || !strings.Contains(body, "POST    /b") {
+		t.Errorf("got text %q", body)
+	}
+
+	removeA()
+	rec = httptest.NewRecorder()
+	reg.ServeHTTP(rec, httptest.NewRequest("GET", "/debug/requests?json", nil))
+	var requests []InFlightRequest
+	if err := json.Unmarshal(rec.Body.Bytes(), &requests); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Header().Get("Content-Type") != "application/json" || len(requests) != 1 || requests[0].Method != "POST" {
+		t.Errorf("got JSON %s", rec.Body.String())
+	}
+
+	removeB()
+	if reg.Len() != 0 {
+		t.Errorf("got %d requests after remove, want 0", reg.Len())
+	}
+}
+
+func TestRequestLogger_Progress(t *testing.T) {
+	tests := []struct {
+		name  string
+		after time.Duration
+		want  []string
+	}{
+		{"running", 10 * time.Millisecond, []string{"request started", "request still running", "request"}},
+		{"done", time.Minute, []string{"request started", "request"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			reg := NewInFlightRegistry()
+			f := NewSlogLogFormatter(slog.New(slog.NewJSONHandler(&out, nil)))
+			h := RequestLogger(f, &RequestLoggerOpts{LogStart: true, StillRunningAfter: tt.after, InFlight: reg})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if reg.Len() != 1 {
+					t.Errorf("got %d requests in flight, want 1", reg.Len())
+				}
+				time.Sleep(50 * time.Millisecond)
+			}))
+			h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+			time.Sleep(20 * time.Millisecond)
+
+			var msgs []string
+			for _, rec := range slogRecords(t, &out) {
+				msgs = append(msgs, rec["msg"].(string))
+			}
+			if strings.Join(msgs, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("got %q, want %q", msgs, tt.want)
+			}
+			if reg.Len() != 0 {
+				t.Errorf("got %d requests in flight after done, want 0", reg.Len())
+			}
+		})
+	}
+}
+
+func TestRequestLogger_ProgressDropped(t *testing.T) {
+	dropped := func(*http.Request) string { return "dropped" }
+	if (&Sampling{OneIn: 1000}).keep(httptest.NewRequest("GET", "/", nil), &ResponseInfo{}) {
+		t.Fatal("the dropped key is kept, choose another key")
+	}
+	tests := []struct {
+		name string
+		path string
+		opts RequestLoggerOpts
+		want []string
+	}{
+		{"ignored route", "/health", RequestLoggerOpts{IgnoreRoutes: []string{"/health"}}, nil},
+		{"ignored param route", "/users/1", RequestLoggerOpts{IgnoreRoutes: []string{"/users/{id}"}}, nil},
+		{"sampled out", "/users/1", RequestLoggerOpts{Sampler: &Sampling{OneIn: 1000, Key: dropped}}, nil},
+		{"sampled out by route", "/health", RequestLoggerOpts{Sampler: &Sampling{RouteOneIn: map[string]int{"/health": 1000}, Key: dropped}}, nil},
+		{"sampler func", "/users/1", RequestLoggerOpts{Sampler: SamplerFunc(func(*http.Request, *ResponseInfo) bool { return false })}, nil},
+		{"filtered", "/users/1", RequestLoggerOpts{Filter: func(*http.Request, *ResponseInfo, bool) bool { return false }}, nil},
+		{"held back", "/users/1", RequestLoggerOpts{Filter: FilterFailed(500)}, []string{"request started", "request still running", "request"}},
+		{"not ignored", "/users/1", RequestLoggerOpts{IgnoreRoutes: []string{"/health"}}, []string{"request started", "request still running", "request"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			opts := tt.opts
+			opts.LogStart, opts.StillRunningAfter = true, 10*time.Millisecond
+			f := NewSlogLogFormatter(slog.New(slog.NewJSONHandler(&out, nil)))
+			handler := func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(30 * time.Millisecond)
+				w.Write([]byte("ok"))
+			}
+			m := chi.NewRouter()
+			m.Use(RequestLogger(f, &opts))
+			m.Get("/health", handler)
+			m.Get("/users/{id}", handler)
+			m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", tt.path, nil))
+
+			var msgs []string
+			if out.Len() > 0 {
+				for _, rec := range slogRecords(t, &out) {
+					msgs = append(msgs, rec["msg"].(string))
+				}
+			}
+			if strings.Join(msgs, ", ") != strings.Join(tt.want, ", ") {
+				t.Errorf("got %q, want %q", msgs, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// JSONLogFormatter is a LogAndPanicFormatter that writes each request and
+// panic as a single JSON object.
+type JSONLogFormatter struct {
+	LogFormatterConfig
+	Logger, PanicLogger LoggerInterface
+}
+
+// NewJSONLogFormatter create JSON request logger. Lines are written without
+// prefix or flags, so each line is a valid JSON object.
+func NewJSONLogFormatter(out, err io.Writer, ignore ...Extensions) *JSONLogFormatter {
+	return &JSONLogFormatter{
+		LogFormatterConfig: newLogFormatterConfig(ignore...),
+		Logger:             log.New(out, "", 0),
+		PanicLogger:        log.New(err, "", 0),
+	}
+}
+
+// JSONLogRecord is the object written by JSONLogFormatter entries.
+type JSONLogRecord struct {
+	// Event is empty on the access line, "start" or "running" on
+	// ProgressLogEntry lines.
+	Event     string                 `json:"event,omitempty"`
+	Time      time.Time              `json:"time"`
+	RemoteIP  string                 `json:"remote_ip,omitempty"`
+	RequestID string                 `json:"request_id,omitempty"`
+	TraceID   string                 `json:"trace_id,omitempty"`
+	SpanID    string                 `json:"span_id,omitempty"`
+	Method    string                 `json:"method"`
+	Scheme    string                 `json:"scheme"`
+	Host      string                 `json:"host"`
+	URI       string                 `json:"uri"`
+	Proto     string                 `json:"proto"`
+	Route     string                 `json:"route,omitempty"`
+	URLParams []URLParam             `json:"url_params,omitempty"`
+	Status    int                    `json:"status"`
+	Pseudo    string                 `json:"pseudo_status,omitempty"`
+	Closed    bool                   `json:"client_closed,omitempty"`
+	WriteErrs int                    `json:"write_errors,omitempty"`
+	WriteErr  string                 `json:"write_error,omitempty"`
+	Bytes     int                    `json:"bytes"`
+	Elapsed   float64                `json:"elapsed_ms"`
+	TTFB      float64                `json:"ttfb_ms,omitempty"`
+	Type      string                 `json:"content_type,omitempty"`
+	Encoding  string                 `json:"content_encoding,omitempty"`
+	Fields    map[string]interface{} `json:"fields,omitempty"`
+	ReqBody   *JSONCapturedBody      `json:"request_body,omitempty"`
+	ResBody   *JSONCapturedBody      `json:"response_body,omitempty"`
+	Panic     string                 `json:"panic,omitempty"`
+	Frames    []StackFrame           `json:"frames,omitempty"`
+	Stack     string                 `json:"stack,omitempty"`
+}
+
+// JSONCapturedBody is the CapturedBody of JSONLogRecord.
+type JSONCapturedBody struct {
+	ContentType string `json:"content_type"`
+	Data        string `json:"data"`
+	Size        int    `json:"size"`
+	Truncated   bool   `json:"truncated,omitempty"`
+}
+
+func newJSONCapturedBody(body *CapturedBody) *JSONCapturedBody {
+	if body == nil {
+		return nil
+	}
+	return &JSONCapturedBody{body.ContentType, string(body.Data), body.Size, body.Truncated}
+}
+
+func newJSONLogRecord(r *http.Request, redactor *Redactor) JSONLogRecord {
+	return JSONLogRecord{
+		Time:      time.Now(),
+		RemoteIP:  GetRealIP(r),
+		RequestID: middleware.GetReqID(r.Context()),
+		TraceID:   GetTraceID(r.Context()),
+		SpanID:    GetSpanID(r.Context()),
+		Method:    r.Method,
+		Scheme:    requestScheme(r),
+		Host:      r.Host,
+		URI:       redactor.URI(r.RequestURI),
+		Proto:     r.Proto,
+	}
+}
+
+// NewLogEntry creates a new LogEntry for the request.
+func (l *JSONLogFormatter) NewLogEntry(r *http.Request) LogEntry {
+	redactor := l.redactor()
+	return &jsonLogEntry{l.Logger, newJSONLogRecord(r, redactor), &LogFields{}, redactor}
+}
+
+// NewPanicEntry creates a new PanicEntry for the request panic.
+func (l *JSONLogFormatter) NewPanicEntry(r *http.Request) PanicEntry {
+	lgr := l.PanicLogger
+	if lgr == nil {
+		lgr = l.Logger
+	}
+	redactor := l.redactor()
+	return &jsonPanicEntry{lgr, newJSONLogRecord(r, redactor), redactor}
+}
+
+// durationMs returns the duration in milliseconds.
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func writeJSONLogRecord(lgr LoggerInterface, rec *JSONLogRecord) {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		b, _ = json.Marshal(map[string]string{"error": err.Error()})
+	}
+	lgr.Print(string(b))
+}
+
+type jsonLogEntry struct {
+	logger   LoggerInterface
+	record   JSONLogRecord
+	fields   *LogFields
+	redactor *Redactor
+}
+
+func (l *jsonLogEntry) Write(status, bytes int, elapsed time.Duration) {
+	l.WriteResponse(&ResponseInfo{Status: status, Bytes: bytes, Elapsed: elapsed})
+}
+
+func (l *jsonLogEntry) WriteResponse(info *ResponseInfo) {
+	rec := l.record
+	rec.Status = info.Status
+	rec.Pseudo = info.PseudoStatus
+	rec.Route = info.RoutePattern
+	rec.URLParams = info.URLParams
+	rec.Closed = info.ClientClosed
+	rec.WriteErrs = info.WriteErrors
+	if info.WriteError != nil {
+		rec.WriteErr = info.WriteError.Error()
+	}
+	rec.Bytes = info.Bytes
+	rec.Elapsed = durationMs(info.Elapsed)
+	rec.TTFB = durationMs(info.TimeToFirstByte())
+	rec.Type = info.ContentType
+	rec.Encoding = info.ContentEncoding
+	rec.ReqBody = newJSONCapturedBody(info.RequestBody.redacted(l.redactor))
+	rec.ResBody = newJSONCapturedBody(info.ResponseBody.redacted(l.redactor))
+	rec.Fields = l.fields.Map()
+	writeJSONLogRecord(l.logger, &rec)
+}
+
+// WriteStart writes the record with "start" event.
+func (l *jsonLogEntry) WriteStart() {
+	rec := l.record
+	rec.Event = "start"
+	writeJSONLogRecord(l.logger, &rec)
+}
+
+// WriteRunning writes the record with "running" event.
+func (l *jsonLogEntry) WriteRunning(elapsed time.Duration) {
+	rec := l.record
+	rec.Event = "running"
+	rec.Time = time.Now()
+	rec.Elapsed = durationMs(elapsed)
+	writeJSONLogRecord(l.logger, &rec)
+}
+
+// SetField sets the key/value written in the `fields` object.
+func (l *jsonLogEntry) SetField(key string, value interface{}) {
+	l.fields.Set(key, value)
+}
+
+func (l jsonLogEntry) WithLogger(logger LoggerInterface) LogEntry {
+	l.logger = logger
+	return &l
+}
+
+type jsonPanicEntry struct {
+	logger   LoggerInterface
+	record   JSONLogRecord
+	redactor *Redactor
+}
+
+func (l *jsonPanicEntry) Write(v interface{}, stackb []byte) {
+	rec := l.record
+	rec.Time = time.Now()
+	rec.Panic = l.redactor.String(fmt.Sprintf("%+v", v))
+	if buckets, err := ParseStack(stackb); err == nil {
+		rec.Frames = StackFrames(buckets)
+	} else {
+		rec.Stack = l.redactor.String(string(stackb))
+	}
+	writeJSONLogRecord(l.logger, &rec)
+}
+
+func (l jsonPanicEntry) WithLogger(logger LoggerInterface) PanicEntry {
+	l.logger = logger
+	return &l
+}
@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"runtime/debug"
+	"testing"
+	"time"
+)
+
+func TestJSONLogFormatter(t *testing.T) {
+	var out, errOut bytes.Buffer
+	f := NewJSONLogFormatter(&out, &errOut)
+	h := RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("POST", "/a?b=c", nil))
+
+	var rec JSONLogRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if rec.Method != "POST" || rec.URI != "/a?b=c" || rec.Status != http.StatusCreated || rec.Bytes != 5 || rec.RemoteIP != "192.0.2.1" {
+		t.Errorf("unexpected record %+v", rec)
+	}
+
+	func() {
+		defer func() {
+			rvr := recover()
+			f.NewPanicEntry(httptest.NewRequest("GET", "/", nil)).Write(rvr, debug.Stack())
+		}()
+		panic("boom")
+	}()
+	rec = JSONLogRecord{}
+	if err := json.Unmarshal(errOut.Bytes(), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", errOut.String(), err)
+	}
+	if rec.Panic != "boom" || len(rec.Frames) == 0 {
+		t.Errorf("unexpected panic record %+v", rec)
+	}
+	if rec.Time.IsZero() || time.Since(rec.Time) > time.Minute {
+		t.Errorf("unexpected panic time %v", rec.Time)
+	}
+}
+
+func TestJSONLogFormatter_ZeroValues(t *testing.T) {
+	var out bytes.Buffer
+	RequestLogger(NewJSONLogFormatter(&out, &out))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	var rec map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	for _, key := range []string{"status", "bytes", "elapsed_ms"} {
+		if _, ok := rec[key]; !ok {
+			t.Errorf("%q not found in %s", key, out.String())
+		}
+	}
+	if rec["bytes"] != float64(0) {
+		t.Errorf("got bytes %v, want 0", rec["bytes"])
+	}
+}
+
+func TestJSONLogFormatter_Route(t *testing.T) {
+	var out bytes.Buffer
+	routeTestRouter(RequestLogger(NewJSONLogFormatter(&out, &out))).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/5", nil))
+
+	var rec JSONLogRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatalf("invalid JSON %q: %v", out.String(), err)
+	}
+	if rec.Route != "/users/{id}" || len(rec.URLParams) != 1 || rec.URLParams[0] != (URLParam{"id", "5"}) {
+		t.Errorf("got route %q and params %v", rec.Route, rec.URLParams)
+	}
+}
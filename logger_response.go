@@ -0,0 +1,356 @@
+package middleware
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// ResponseInfo is the response data collected by RequestLogger.
+type ResponseInfo struct {
+	Status, Bytes   int
+	Elapsed         time.Duration
+	Start           time.Time
+	FirstByte       time.Time
+	Header          http.Header
+	ContentType     string
+	ContentEncoding string
+	// RequestBody and ResponseBody are the captured bodies, if enabled by
+	// RequestLoggerOpts.BodyCapture and the content type is accepted.
+	RequestBody, ResponseBody *CapturedBody
+	// Panicked is true if the handler panicked (or called runtime.Goexit).
+	Panicked bool
+	// ClientClosed is true if the client closed the request before the
+	// response completed: the request context was canceled or a write failed
+	// with a connection error (broken pipe, connection reset).
+	ClientClosed bool
+	// ClientClosedAt is the time the request context was canceled.
+	ClientClosedAt time.Time
+	// WriteErrors is the number of failed writes and WriteError the last.
+	WriteErrors int
+	WriteError  error
+	// RoutePattern and URLParams are the chi route pattern matched by the
+	// request and its URL params. See RoutePattern.
+	RoutePattern string
+	URLParams    []URLParam
+	// PseudoStatus explains why the handler never wrote a status, one of the
+	// PseudoStatus* constants. Status is 200 for PseudoStatusImplicit200,
+	// StatusClientClosedRequest for PseudoStatusClientClosed, otherwise 0.
+	PseudoStatus string
+}
+
+// StatusClientClosedRequest is the nginx non standard status used when the
+// client closes the connection before the response.
+const StatusClientClosedRequest = 499
+
+// Pseudo status of the requests that never wrote a status.
+const (
+	// PseudoStatusImplicit200 is the handler returned without writing, so
+	// net/http sends 200.
+	PseudoStatusImplicit200 = "implicit-200"
+	// PseudoStatusHijacked is the connection was hijacked.
+	PseudoStatusHijacked = "hijacked"
+	// PseudoStatusClientClosed is the client closed the request.
+	PseudoStatusClientClosed = "client-closed"
+	// PseudoStatusPanicked is the handler panicked before writing.
+	PseudoStatusPanicked = "panicked"
+)
+
+// setPseudoStatus sets the PseudoStatus and Status of the unwritten response.
+func (i *ResponseInfo) setPseudoStatus(hijacked bool) {
+	switch {
+	case hijacked:
+		i.PseudoStatus = PseudoStatusHijacked
+	case i.Panicked:
+		i.PseudoStatus = PseudoStatusPanicked
+	case i.ClientClosed:
+		i.PseudoStatus = PseudoStatusClientClosed
+		i.Status = StatusClientClosedRequest
+	default:
+		i.PseudoStatus = PseudoStatusImplicit200
+		i.Status = http.StatusOK
+	}
+}
+
+// StatusText returns the PseudoStatus if set, otherwise the status code.
+func (i *ResponseInfo) StatusText() string {
+	if i.PseudoStatus != "" {
+		return i.PseudoStatus
+	}
+	return strconv.Itoa(i.Status)
+}
+
+// TimeToFirstByte returns the elapsed time until the first response byte
+// was written, or zero if nothing was written.
+func (i *ResponseInfo) TimeToFirstByte() time.Duration {
+	if i.FirstByte.IsZero() {
+		return 0
+	}
+	return i.FirstByte.Sub(i.Start)
+}
+
+// ResponseLogEntry is a LogEntry that receives the full response data.
+// RequestLogger calls WriteResponse instead of Write on entries that
+// implement it.
+type ResponseLogEntry interface {
+	LogEntry
+	WriteResponse(info *ResponseInfo)
+}
+
+// UpgradeLogEntry returns the entry as ResponseLogEntry. Entries that only
+// implement LogEntry are adapted to Write the status, bytes and elapsed. They
+// can not write a PseudoStatus, so the requests without status (hijacked or
+// panicked before writing) are not written to them.
+func UpgradeLogEntry(entry LogEntry) ResponseLogEntry {
+	if e, ok := entry.(ResponseLogEntry); ok {
+		return e
+	}
+	return upgradedLogEntry{entry}
+}
+
+// WriteLogEntry writes the response info to the entry.
+func WriteLogEntry(entry LogEntry, info *ResponseInfo) {
+	UpgradeLogEntry(entry).WriteResponse(info)
+}
+
+type upgradedLogEntry struct {
+	LogEntry
+}
+
+func (e upgradedLogEntry) WriteResponse(info *ResponseInfo) {
+	if info.Status == 0 {
+		return
+	}
+	e.Write(info.Status, info.Bytes, info.Elapsed)
+}
+
+// responseRecorder is the response writer of RequestLogger, Observe and
+// Recoverer. It records the response status, size and the other ResponseInfo
+// data.
+type responseRecorder struct {
+	http.ResponseWriter
+	status    int
+	bytes     int
+	firstByte time.Time
+	hijacked  bool
+	ctx       context.Context
+	closedAt  atomic.Int64
+	writeErrs int
+	writeErr  error
+
+	capturer         *bodyCapturer
+	captureChecked   bool
+	reqBody, resBody *bodyBuffer
+}
+
+// newResponseRecorder wraps the w. The wrapper satisfies http.Flusher,
+// http.Hijacker and http.Pusher only if w does. It always satisfies
+// io.ReaderFrom, falling back to io.Copy.
+func newResponseRecorder(w http.ResponseWriter) (http.ResponseWriter, *responseRecorder) {
+	rec := &responseRecorder{ResponseWriter: w}
+	_, flusher := w.(http.Flusher)
+	_, hijacker := w.(http.Hijacker)
+	_, pusher := w.(http.Pusher)
+	switch {
+	case flusher && hijacker:
+		return struct {
+			*responseRecorder
+			http.Flusher
+			http.Hijacker
+		}{rec, recorderFlusher{rec}, recorderHijacker{rec}}, rec
+	case flusher && pusher:
+		return struct {
+			*responseRecorder
+			http.Flusher
+			http.Pusher
+		}{rec, recorderFlusher{rec}, recorderPusher{rec}}, rec
+	case flusher:
+		return struct {
+			*responseRecorder
+			http.Flusher
+		}{rec, recorderFlusher{rec}}, rec
+	case hijacker:
+		return struct {
+			*responseRecorder
+			http.Hijacker
+		}{rec, recorderHijacker{rec}}, rec
+	case pusher:
+		return struct {
+			*responseRecorder
+			http.Pusher
+		}{rec, recorderPusher{rec}}, rec
+	}
+	return rec, rec
+}
+
+// Unwrap returns the wrapped writer, for http.ResponseController.
+func (w *responseRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Status returns the response status, or 0 if not written.
+func (w *responseRecorder) Status() int {
+	return w.status
+}
+
+// BytesWritten returns the written body size.
+func (w *responseRecorder) BytesWritten() int {
+	return w.bytes
+}
+
+func (w *responseRecorder) WriteHeader(code int) {
+	// the informational (1xx) headers are followed by the final status
+	if w.status == 0 && (code < 100 || code >= 200) {
+		w.status = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *responseRecorder) markFirstByte() {
+	if w.firstByte.IsZero() {
+		w.firstByte = time.Now()
+	}
+}
+
+// captureBody enables the request and response body capture.
+func (w *responseRecorder) captureBody(c *bodyCapturer, r *http.Request) {
+	w.capturer = c
+	w.reqBody = c.captureRequest(r)
+}
+
+func (w *responseRecorder) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		w.markFirstByte()
+	}
+	if w.capturer != nil && !w.captureChecked {
+		w.captureChecked = true
+		ct := w.Header().Get("Content-Type")
+		if ct == "" {
+			ct = http.DetectContentType(p)
+		}
+		if w.capturer.accept(ct) {
+			w.resBody = w.capturer.newBuffer(ct)
+		}
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += n
+	if w.resBody != nil {
+		w.resBody.Write(p[:n])
+	}
+	if err != nil {
+		w.writeError(err)
+	}
+	return n, err
+}
+
+func (w *responseRecorder) writeError(err error) {
+	w.writeErrs++
+	w.writeErr = err
+}
+
+// watchClient records when the request context is canceled, until the
+// returned stop func is called.
+func (w *responseRecorder) watchClient(ctx context.Context) (stop func() bool) {
+	w.ctx = ctx
+	return context.AfterFunc(ctx, func() {
+		if ctx.Err() == context.Canceled {
+			w.closedAt.CompareAndSwap(0, time.Now().UnixNano())
+		}
+	})
+}
+
+// committed reports whether the response status or body was sent, or the
+// connection hijacked.
+func (w *responseRecorder) committed() bool {
+	return w.Status() != 0 || !w.firstByte.IsZero() || w.hijacked
+}
+
+// Info returns the response info of the request started at start.
+func (w *responseRecorder) Info(start time.Time) *ResponseInfo {
+	header := w.Header()
+	info := &ResponseInfo{
+		Status:          w.Status(),
+		Bytes:           w.BytesWritten(),
+		Elapsed:         time.Since(start),
+		Start:           start,
+		FirstByte:       w.firstByte,
+		Header:          header,
+		ContentType:     header.Get("Content-Type"),
+		ContentEncoding: header.Get("Content-Encoding"),
+		RequestBody:     w.reqBody.Body(),
+		ResponseBody:    w.resBody.Body(),
+		WriteErrors:     w.writeErrs,
+		WriteError:      w.writeErr,
+	}
+	if w.ctx != nil && w.ctx.Err() == context.Canceled {
+		// the AfterFunc may not have run yet
+		w.closedAt.CompareAndSwap(0, time.Now().UnixNano())
+	}
+	if closedAt := w.closedAt.Load(); closedAt != 0 {
+		info.ClientClosed = true
+		info.ClientClosedAt = time.Unix(0, closedAt)
+	} else if w.writeErr != nil && isConnError(w.writeErr) {
+		info.ClientClosed = true
+	}
+	return info
+}
+
+// ReadFrom implements io.ReaderFrom, using the ReadFrom of the wrapped
+// writer if any, otherwise io.Copy.
+func (w *responseRecorder) ReadFrom(r io.Reader) (int64, error) {
+	rf, ok := w.ResponseWriter.(io.ReaderFrom)
+	if !ok || w.capturer != nil {
+		// hide ReadFrom, so io.Copy writes through the capture
+		return io.Copy(struct{ io.Writer }{w}, r)
+	}
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.markFirstByte()
+	n, err := rf.ReadFrom(r)
+	w.bytes += int(n)
+	if err != nil {
+		w.writeError(err)
+	}
+	return n, err
+}
+
+type recorderFlusher struct {
+	*responseRecorder
+}
+
+func (w recorderFlusher) Flush() {
+	w.markFirstByte()
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	w.ResponseWriter.(http.Flusher).Flush()
+}
+
+type recorderHijacker struct {
+	*responseRecorder
+}
+
+func (w recorderHijacker) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := w.ResponseWriter.(http.Hijacker).Hijack()
+	if err == nil {
+		w.hijacked = true
+	}
+	return conn, rw, err
+}
+
+type recorderPusher struct {
+	*responseRecorder
+}
+
+func (w recorderPusher) Push(target string, opts *http.PushOptions) error {
+	return w.ResponseWriter.(http.Pusher).Push(target, opts)
+}
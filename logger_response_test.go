@@ -0,0 +1,280 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recordLogFormatter records the ResponseInfo of the requests.
+type recordLogFormatter struct {
+	mu    sync.Mutex
+	infos []*ResponseInfo
+}
+
+func (f *recordLogFormatter) Accept(*http.Request) bool { return true }
+
+func (f *recordLogFormatter) NewLogEntry(*http.Request) LogEntry { return &recordLogEntry{f} }
+
+func (f *recordLogFormatter) last(t *testing.T) *ResponseInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if len(f.infos) == 0 {
+		t.Fatal("no request logged")
+	}
+	return f.infos[len(f.infos)-1]
+}
+
+type recordLogEntry struct {
+	f *recordLogFormatter
+}
+
+func (e *recordLogEntry) Write(status, bytes int, elapsed time.Duration) {}
+
+func (e *recordLogEntry) WriteResponse(info *ResponseInfo) {
+	e.f.mu.Lock()
+	e.f.infos = append(e.f.infos, info)
+	e.f.mu.Unlock()
+}
+
+func (e *recordLogEntry) WithLogger(LoggerInterface) LogEntry { return e }
+
+// legacyLogEntry is a LogEntry that only implements Write.
+type legacyLogEntry struct {
+	status, bytes int
+	written       bool
+}
+
+func (e *legacyLogEntry) Write(status, bytes int, elapsed time.Duration) {
+	e.status, e.bytes, e.written = status, bytes, true
+}
+
+func (e *legacyLogEntry) WithLogger(LoggerInterface) LogEntry { return e }
+
+type legacyLogFormatter struct {
+	entry legacyLogEntry
+}
+
+func (f *legacyLogFormatter) Accept(*http.Request) bool { return true }
+
+func (f *legacyLogFormatter) NewLogEntry(*http.Request) LogEntry {
+	f.entry = legacyLogEntry{}
+	return &f.entry
+}
+
+func TestRequestLogger_ResponseInfo(t *testing.T) {
+	f := &recordLogFormatter{}
+	RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set("Content-Encoding", "gzip")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello"))
+		time.Sleep(5 * time.Millisecond)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	info := f.last(t)
+	if info.Status != http.StatusAccepted || info.Bytes != 5 || info.ContentType != "text/plain" || info.ContentEncoding != "gzip" {
+		t.Errorf("unexpected info: %+v", info)
+	}
+	if ttfb := info.TimeToFirstByte(); ttfb < 5*time.Millisecond || ttfb >= info.Elapsed {
+		t.Errorf("ttfb: got %s, elapsed %s", ttfb, info.Elapsed)
+	}
+
+	RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if info := f.last(t); !info.FirstByte.IsZero() || info.TimeToFirstByte() != 0 {
+		t.Errorf("ttfb without body: got %s", info.TimeToFirstByte())
+	}
+}
+
+func TestUpgradeLogEntry(t *testing.T) {
+	f := &legacyLogFormatter{}
+	RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("hello"))
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if e := f.entry; !e.written || e.status != http.StatusCreated || e.bytes != 5 {
+		t.Errorf("legacy entry: got %+v", e)
+	}
+
+	re := &recordLogEntry{}
+	if UpgradeLogEntry(re) != ResponseLogEntry(re) {
+		t.Error("ResponseLogEntry was adapted")
+	}
+}
+
+func TestRequestLogger_PseudoStatus(t *testing.T) {
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		ctx     context.Context
+		status  int
+		pseudo  string
+		clf     string
+	}{
+		{"implicit 200", func(w http.ResponseWriter, r *http.Request) {}, nil, http.StatusOK, PseudoStatusImplicit200, `" 200 -`},
+		{"panicked", func(w http.ResponseWriter, r *http.Request) { panic("boom") }, nil, 0, PseudoStatusPanicked, `" - -`},
+		{"client closed", func(w http.ResponseWriter, r *http.Request) {}, canceled, StatusClientClosedRequest, PseudoStatusClientClosed, `" 499 -`},
+		{"written", func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusNoContent) }, canceled, http.StatusNoContent, "", `" 204 -`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, skip := range []bool{false, true} {
+				var clf bytes.Buffer
+				f, legacy := &recordLogFormatter{}, &legacyLogFormatter{}
+				r := httptest.NewRequest("GET", "/", nil)
+				if tt.ctx != nil {
+					r = r.WithContext(tt.ctx)
+				}
+				for _, lf := range []LogFormatter{f, legacy, NewCommonLogFormatter(&clf)} {
+					func() {
+						defer func() { recover() }()
+						RequestLogger(lf, &RequestLoggerOpts{SkipUnwritten: skip})(tt.handler).ServeHTTP(httptest.NewRecorder(), r)
+					}()
+				}
+				if skip && tt.pseudo != "" {
+					if len(f.infos) != 0 || legacy.entry.written || clf.Len() != 0 {
+						t.Errorf("SkipUnwritten: logged %+v %q", f.infos, clf.String())
+					}
+					continue
+				}
+				info := f.last(t)
+				if info.Status != tt.status || info.PseudoStatus != tt.pseudo {
+					t.Errorf("got status %d %q, want %d %q", info.Status, info.PseudoStatus, tt.status, tt.pseudo)
+				}
+				// LogEntry only entries do not receive the requests without status
+				if legacy.entry.written != (tt.status != 0) || legacy.entry.status != tt.status {
+					t.Errorf("legacy entry: got %+v", legacy.entry)
+				}
+				if !strings.HasSuffix(clf.String(), tt.clf+"\n") {
+					t.Errorf("common log: got %q, want suffix %q", clf.String(), tt.clf)
+				}
+			}
+		})
+	}
+}
+
+func TestRequestLogger_Hijacked(t *testing.T) {
+	var clf bytes.Buffer
+	f, legacy := &recordLogFormatter{}, &legacyLogFormatter{}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n")
+		rw.Flush()
+		conn.Close()
+	})
+	for _, lf := range []LogFormatter{f, legacy, NewCommonLogFormatter(&clf)} {
+		h, done := RequestLogger(lf)(handler), make(chan struct{})
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			h.ServeHTTP(w, r)
+			close(done)
+		}))
+		res, err := http.Get(ts.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+		<-done
+		ts.Close()
+	}
+	if info := f.last(t); info.Status != 0 || info.PseudoStatus != PseudoStatusHijacked {
+		t.Errorf("got status %d %q, want hijacked", info.Status, info.PseudoStatus)
+	}
+	if legacy.entry.written {
+		t.Errorf("legacy entry: got %+v", legacy.entry)
+	}
+	if got := clf.String(); !strings.HasSuffix(got, `"GET / HTTP/1.1" - -`+"\n") {
+		t.Errorf("common log: got %q", got)
+	}
+}
+
+// failWriter is a ResponseWriter whose writes fail with err.
+type failWriter struct {
+	*httptest.ResponseRecorder
+	err error
+}
+
+func (w failWriter) Write([]byte) (int, error) { return 0, w.err }
+
+func TestRequestLogger_ClientClosed(t *testing.T) {
+	f := &recordLogFormatter{}
+	ctx, cancel := context.WithCancel(context.Background())
+	var canceledAt time.Time
+	RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		canceledAt = time.Now()
+		cancel()
+		<-r.Context().Done()
+		w.WriteHeader(http.StatusOK)
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil).WithContext(ctx))
+	info := f.last(t)
+	if !info.ClientClosed || info.ClientClosedAt.Before(canceledAt) || info.ClientClosedAt.After(time.Now()) {
+		t.Errorf("got client closed %v at %v, canceled at %v", info.ClientClosed, info.ClientClosedAt, canceledAt)
+	}
+	if info.Status != http.StatusOK || info.PseudoStatus != "" {
+		t.Errorf("got status %d %q, want 200", info.Status, info.PseudoStatus)
+	}
+
+	tests := []struct {
+		err          error
+		clientClosed bool
+	}{
+		{fmt.Errorf("write: %w", net.ErrClosed), true},
+		{errors.New("disk full"), false},
+	}
+	for _, tt := range tests {
+		RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("a"))
+			w.Write([]byte("b"))
+		})).ServeHTTP(failWriter{httptest.NewRecorder(), tt.err}, httptest.NewRequest("GET", "/", nil))
+		info := f.last(t)
+		if info.WriteErrors != 2 || info.WriteError != tt.err || info.ClientClosed != tt.clientClosed {
+			t.Errorf("%v: got %d write errors, last %v, client closed %v", tt.err, info.WriteErrors, info.WriteError, info.ClientClosed)
+		}
+		if !info.ClientClosedAt.IsZero() {
+			t.Errorf("%v: got client closed at %v, want zero", tt.err, info.ClientClosedAt)
+		}
+	}
+}
+
+func TestResponseRecorder_Interfaces(t *testing.T) {
+	middlewares := map[string]func(http.Handler) http.Handler{
+		"RequestLogger": RequestLogger(&recordLogFormatter{}),
+		"Observe":       Observe(func(*http.Request, *ResponseInfo) {}),
+		"Recoverer":     Recoverer(quietPanicFormatter()),
+	}
+	for name, mw := range middlewares {
+		// httptest.ResponseRecorder is only a http.Flusher
+		w := httptest.NewRecorder()
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := w.(http.Hijacker); ok {
+				t.Errorf("%s: the writer is a http.Hijacker", name)
+			}
+			if _, ok := w.(http.Pusher); ok {
+				t.Errorf("%s: the writer is a http.Pusher", name)
+			}
+			if _, ok := w.(http.Flusher); !ok {
+				t.Errorf("%s: the writer is not a http.Flusher", name)
+			}
+			http.ServeContent(w, r, "a.txt", time.Time{}, strings.NewReader("hello"))
+		})).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if w.Code != http.StatusOK || w.Body.String() != "hello" {
+			t.Errorf("%s: got %d %q", name, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// URLParam is a chi URL param.
+type URLParam struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// RoutePattern returns the chi route pattern matched by the request, like
+// "/users/{id}", or empty if the request was not routed by chi.
+func RoutePattern(r *http.Request) string {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return rctx.RoutePattern()
+	}
+	return ""
+}
+
+// matchRoutePattern returns the chi route pattern that the request will
+// match, before the routing. Ok is false if the request is not served by a
+// chi router.
+func matchRoutePattern(r *http.Request) (pattern string, ok bool) {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil || rctx.Routes == nil {
+		return "", false
+	}
+	// the Routes is the top router, so it matches the full path
+	path := r.URL.RawPath
+	if path == "" {
+		path = r.URL.Path
+	}
+	mctx := chi.NewRouteContext()
+	if rctx.Routes.Match(mctx, r.Method, path) {
+		pattern = mctx.RoutePattern()
+	}
+	return pattern, true
+}
+
+// URLParams returns the chi URL params of the request.
+func URLParams(r *http.Request) (params []URLParam) {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		for i, key := range rctx.URLParams.Keys {
+			if i >= len(rctx.URLParams.Values) {
+				break
+			}
+			// subrouters mounts add an empty catch-all param
+			if value := rctx.URLParams.Values[i]; key != "" && (key != "*" || value != "") {
+				params = append(params, URLParam{key, value})
+			}
+		}
+	}
+	return
+}
+
+// routeLogFields returns the route pattern and URL params as log fields.
+func routeLogFields(info *ResponseInfo, route, params bool) (fields []LogField) {
+	if route && info.RoutePattern != "" {
+		fields = append(fields, LogField{"route", info.RoutePattern})
+	}
+	if params {
+		for _, p := range info.URLParams {
+			fields = append(fields, LogField{"param." + p.Key, p.Value})
+		}
+	}
+	return
+}
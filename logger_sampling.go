@@ -0,0 +1,195 @@
+package middleware
+
+import (
+	"fmt"
+	"hash/fnv"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// Sampler decides if the completed request is logged by RequestLogger.
+type Sampler interface {
+	Sample(r *http.Request, info *ResponseInfo) bool
+}
+
+// RequestSampler is a Sampler that also decides before the handler runs, so
+// RequestLogger does not write the progress lines of the requests it drops.
+// The route is the chi route pattern the request will match, if known.
+type RequestSampler interface {
+	Sampler
+	SampleRequest(r *http.Request, route string) bool
+}
+
+// SamplerFunc is a func Sampler.
+type SamplerFunc func(r *http.Request, info *ResponseInfo) bool
+
+func (f SamplerFunc) Sample(r *http.Request, info *ResponseInfo) bool {
+	return f(r, info)
+}
+
+// DefaultSamplingSummaryInterval is the default interval of the dropped lines
+// summary.
+const DefaultSamplingSummaryInterval = 10 * time.Second
+
+// Sampling is a Sampler that keeps 1 in N requests, but always keeps errors,
+// slow requests, panics, the requests without a written status (see
+// ResponseInfo.PseudoStatus) and the requests closed by the client. The lines
+// are limited to RateLimit per second (panics, requests without status and
+// closed by the client are never dropped) and a "N lines dropped" summary is logged
+// periodically by a timer, also when the traffic stops. Call Flush on
+// shutdown to log the pending summary.
+//
+// The sampling is deterministic per key (the request ID by default), so
+// related logs stay together.
+type Sampling struct {
+	// OneIn keeps 1 in N of the requests not always kept. Values lower than
+	// 2 keeps all.
+	OneIn int
+	// RouteOneIn overrides OneIn by chi route pattern (see RoutePattern).
+	RouteOneIn map[string]int
+	// MinErrorStatus is the minimum status always kept. Default is 500.
+	MinErrorStatus int
+	// SlowThreshold is the minimum elapsed time always kept. Zero disables.
+	SlowThreshold time.Duration
+	// RateLimit is the max lines per second. Zero disables.
+	RateLimit int
+	// Logger receives the dropped lines summary. Default is log.Default().
+	Logger LoggerInterface
+	// SummaryInterval is the interval between dropped lines summaries.
+	// Default is DefaultSamplingSummaryInterval.
+	SummaryInterval time.Duration
+	// Key returns the sampling key of the request. Default is the request ID.
+	// Requests without key are sampled by arrival order.
+	Key func(r *http.Request) string
+
+	counter uint64
+
+	mu          sync.Mutex
+	window      time.Time
+	windowCount int
+	dropped     int
+	summary     *time.Timer
+}
+
+// Sample implements Sampler.
+func (s *Sampling) Sample(r *http.Request, info *ResponseInfo) bool {
+	if info.Panicked || info.PseudoStatus != "" || info.ClientClosed {
+		return true
+	}
+	if !s.keep(r, info) {
+		return false
+	}
+	return s.allow()
+}
+
+// SampleRequest implements RequestSampler. It decides by the key only, so the
+// requests later always kept, like errors, may have no progress lines, and
+// the sampled requests without key have none.
+func (s *Sampling) SampleRequest(r *http.Request, route string) bool {
+	oneIn := s.oneIn(route)
+	if oneIn < 2 {
+		return true
+	}
+	key := s.key(r)
+	return key != "" && keyHash(key)%uint32(oneIn) == 0
+}
+
+// keep reports whether the request is kept by the sampling rules.
+func (s *Sampling) keep(r *http.Request, info *ResponseInfo) bool {
+	minStatus := s.MinErrorStatus
+	if minStatus == 0 {
+		minStatus = 500
+	}
+	oneIn := s.oneIn(info.RoutePattern)
+	if info.Status >= minStatus || (s.SlowThreshold > 0 && info.Elapsed >= s.SlowThreshold) || oneIn < 2 {
+		return true
+	}
+	key := s.key(r)
+	if key == "" {
+		return atomic.AddUint64(&s.counter, 1)%uint64(oneIn) == 0
+	}
+	return keyHash(key)%uint32(oneIn) == 0
+}
+
+// oneIn returns the OneIn of the route.
+func (s *Sampling) oneIn(route string) int {
+	if n, ok := s.RouteOneIn[route]; ok {
+		return n
+	}
+	return s.OneIn
+}
+
+// key returns the sampling key of the request.
+func (s *Sampling) key(r *http.Request) string {
+	if s.Key != nil {
+		return s.Key(r)
+	}
+	return middleware.GetReqID(r.Context())
+}
+
+func keyHash(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
+
+// allow applies the rate limit.
+func (s *Sampling) allow() bool {
+	if s.RateLimit <= 0 {
+		return true
+	}
+	now := time.Now()
+	s.mu.Lock()
+	if now.Sub(s.window) >= time.Second {
+		s.window, s.windowCount = now, 0
+	}
+	allowed := s.windowCount < s.RateLimit
+	if allowed {
+		s.windowCount++
+	} else {
+		s.dropped++
+		if s.summary == nil {
+			// the first drop since the last summary schedules the next one
+			interval := s.SummaryInterval
+			if interval <= 0 {
+				interval = DefaultSamplingSummaryInterval
+			}
+			s.summary = time.AfterFunc(interval, s.Flush)
+		}
+	}
+	s.mu.Unlock()
+	return allowed
+}
+
+// Flush logs the dropped lines summary, if any line was dropped since the
+// last summary.
+func (s *Sampling) Flush() {
+	s.mu.Lock()
+	dropped := s.dropped
+	s.dropped = 0
+	if s.summary != nil {
+		s.summary.Stop()
+		s.summary = nil
+	}
+	s.mu.Unlock()
+
+	if dropped > 0 {
+		lgr := s.Logger
+		if lgr == nil {
+			lgr = log.Default()
+		}
+		lgr.Print(fmt.Sprintf("%d log lines dropped by rate limit of %d/s", dropped, s.RateLimit))
+	}
+}
+
+// Dropped returns the lines dropped by rate limit not yet summarized.
+func (s *Sampling) Dropped() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
@@ -0,0 +1,120 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+func TestSampling_Key(t *testing.T) {
+	s := &Sampling{OneIn: 4}
+	kept := 0
+	for i := 0; i < 400; i++ {
+		r := httptest.NewRequest("GET", "/", nil)
+		r = r.WithContext(context.WithValue(r.Context(), middleware.RequestIDKey, fmt.Sprintf("req-%d", i)))
+		keep := s.Sample(r, &ResponseInfo{Status: 200})
+		for j := 0; j < 3; j++ {
+			if s.Sample(r, &ResponseInfo{Status: 200}) != keep {
+				t.Fatalf("request %d: sampling is not deterministic", i)
+			}
+		}
+		if keep {
+			kept++
+		}
+	}
+	if kept < 50 || kept > 150 {
+		t.Errorf("kept %d of 400, want about 100", kept)
+	}
+}
+
+func TestSampling_AlwaysKept(t *testing.T) {
+	s := &Sampling{OneIn: 1000, SlowThreshold: time.Second, Key: func(*http.Request) string { return "dropped" }}
+	r := httptest.NewRequest("GET", "/", nil)
+	if s.Sample(r, &ResponseInfo{Status: 200}) {
+		t.Fatal("the request is kept, choose another key")
+	}
+	for name, info := range map[string]*ResponseInfo{
+		"5xx":      {Status: 503},
+		"slow":     {Status: 200, Elapsed: 2 * time.Second},
+		"panicked": {Panicked: true},
+		"hijacked": {PseudoStatus: PseudoStatusHijacked},
+		"implicit": {Status: 200, PseudoStatus: PseudoStatusImplicit200},
+		"closed":   {Status: 200, ClientClosed: true},
+	} {
+		if !s.Sample(r, info) {
+			t.Errorf("%s: dropped", name)
+		}
+	}
+}
+
+func TestSampling_RouteOneIn(t *testing.T) {
+	s := &Sampling{OneIn: 1000, RouteOneIn: map[string]int{"/users/{id}": 1, "/health": 1000}, Key: func(*http.Request) string { return "dropped" }}
+	r := httptest.NewRequest("GET", "/", nil)
+	for route, want := range map[string]bool{"/users/{id}": true, "/health": false, "/other": false} {
+		if got := s.Sample(r, &ResponseInfo{Status: 200, RoutePattern: route}); got != want {
+			t.Errorf("%s: got %v, want %v", route, got, want)
+		}
+	}
+	s.OneIn = 1
+	if s.Sample(r, &ResponseInfo{Status: 200, RoutePattern: "/health"}) {
+		t.Error("/health: kept with OneIn 1")
+	}
+	if !s.Sample(r, &ResponseInfo{Status: 200, RoutePattern: "/other"}) {
+		t.Error("/other: dropped with OneIn 1")
+	}
+}
+
+func TestSampling_RateLimit(t *testing.T) {
+	var out syncBuffer
+	s := &Sampling{RateLimit: 2, SummaryInterval: 20 * time.Millisecond, Logger: log.New(&out, "", 0)}
+	r := httptest.NewRequest("GET", "/", nil)
+	var kept int
+	for i := 0; i < 5; i++ {
+		if s.Sample(r, &ResponseInfo{Status: 200}) {
+			kept++
+		}
+	}
+	if !s.Sample(r, &ResponseInfo{Panicked: true}) {
+		t.Error("panicked request dropped")
+	}
+	if kept != 2 || s.Dropped() != 3 {
+		t.Fatalf("kept %d and dropped %d, want 2 and 3", kept, s.Dropped())
+	}
+
+	// the summary is written without new requests
+	deadline := time.Now().Add(time.Second)
+	for out.String() == "" && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if want := "3 log lines dropped by rate limit of 2/s\n"; out.String() != want {
+		t.Errorf("got summary %q, want %q", out.String(), want)
+	}
+	if s.Dropped() != 0 {
+		t.Errorf("got %d dropped after the summary, want 0", s.Dropped())
+	}
+}
+
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf strings.Builder
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
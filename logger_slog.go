@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// SlogLogFormatter is a LogAndPanicFormatter that sends each completed request
+// and each panic to a *slog.Logger as attributes.
+//
+// The entries are also slog.Handler, so the handler code can add attributes
+// to the final access line:
+//
+//	GetSlogLogger(r).With("user", userID).Info("user loaded")
+type SlogLogFormatter struct {
+	LogFormatterConfig
+	Logger *slog.Logger
+}
+
+// NewSlogLogFormatter create slog request logger. If logger is nil, uses
+// slog.Default().
+func NewSlogLogFormatter(logger *slog.Logger, ignore ...Extensions) *SlogLogFormatter {
+	return &SlogLogFormatter{
+		LogFormatterConfig: newLogFormatterConfig(ignore...),
+		Logger:             logger,
+	}
+}
+
+func (l *SlogLogFormatter) logger() *slog.Logger {
+	if l.Logger == nil {
+		return slog.Default()
+	}
+	return l.Logger
+}
+
+// NewLogEntry creates a new LogEntry for the request.
+func (l *SlogLogFormatter) NewLogEntry(r *http.Request) LogEntry {
+	return &slogLogEntry{logger: l.logger(), request: r, attrs: &slogAttrs{}, redactor: l.redactor()}
+}
+
+// NewPanicEntry creates a new PanicEntry for the request panic.
+func (l *SlogLogFormatter) NewPanicEntry(r *http.Request) PanicEntry {
+	return &slogPanicEntry{slogLogEntry{logger: l.logger(), request: r, attrs: &slogAttrs{}, redactor: l.redactor()}}
+}
+
+// GetSlogLogger returns a *slog.Logger writing through the in-context
+// LogEntry, if it is a slog.Handler, otherwise slog.Default().
+func GetSlogLogger(r *http.Request) *slog.Logger {
+	if h, ok := GetLogEntry(r).(slog.Handler); ok {
+		return slog.New(h)
+	}
+	return slog.Default()
+}
+
+// StatusLevel returns the slog level for the response status.
+func StatusLevel(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// slogAttrs is the attribute list shared by the entry and its handlers.
+type slogAttrs struct {
+	mu    sync.Mutex
+	attrs []slog.Attr
+}
+
+// set sets the attributes replacing the ones with the same key. The groups
+// are merged.
+func (a *slogAttrs) set(attrs ...slog.Attr) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, attr := range attrs {
+		a.attrs = setSlogAttr(a.attrs, attr)
+	}
+}
+
+func setSlogAttr(attrs []slog.Attr, attr slog.Attr) []slog.Attr {
+	for i := range attrs {
+		if attrs[i].Key != attr.Key {
+			continue
+		}
+		if attr.Value.Kind() == slog.KindGroup && attrs[i].Value.Kind() == slog.KindGroup {
+			group := append([]slog.Attr(nil), attrs[i].Value.Group()...)
+			for _, ga := range attr.Value.Group() {
+				group = setSlogAttr(group, ga)
+			}
+			attr.Value = slog.GroupValue(group...)
+		}
+		attrs[i] = attr
+		return attrs
+	}
+	return append(attrs, attr)
+}
+
+func (a *slogAttrs) get() []slog.Attr {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]slog.Attr(nil), a.attrs...)
+}
+
+type slogLogEntry struct {
+	logger   *slog.Logger
+	request  *http.Request
+	attrs    *slogAttrs
+	handler  slog.Handler
+	groups   []string
+	redactor *Redactor
+}
+
+func (l *slogLogEntry) requestAttrs() []slog.Attr {
+	r := l.request
+	attrs := []slog.Attr{
+		slog.String("remote_ip", GetRealIP(r)),
+		slog.String("method", r.Method),
+		slog.String("scheme", requestScheme(r)),
+		slog.String("host", r.Host),
+		slog.String("uri", l.redactor.URI(r.RequestURI)),
+		slog.String("proto", r.Proto),
+	}
+	if reqID := middleware.GetReqID(r.Context()); reqID != "" {
+		attrs = append(attrs, slog.String("request_id", reqID))
+	}
+	if tc := GetTraceContext(r.Context()); tc != nil {
+		attrs = append(attrs, slog.String("trace_id", tc.TraceID), slog.String("span_id", tc.SpanID))
+	}
+	return attrs
+}
+
+func (l *slogLogEntry) log(level slog.Level, msg string, attrs ...slog.Attr) {
+	ctx := l.request.Context()
+	if !l.logger.Enabled(ctx, level) {
+		return
+	}
+	attrs = append(append(l.requestAttrs(), attrs...), l.attrs.get()...)
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (l *slogLogEntry) Write(status, bytes int, elapsed time.Duration) {
+	l.WriteResponse(&ResponseInfo{Status: status, Bytes: bytes, Elapsed: elapsed})
+}
+
+func (l *slogLogEntry) WriteResponse(info *ResponseInfo) {
+	attrs := []slog.Attr{
+		slog.Int("status", info.Status),
+		slog.Int("bytes", info.Bytes),
+		slog.Duration("elapsed", info.Elapsed),
+	}
+	level := StatusLevel(info.Status)
+	if info.PseudoStatus != "" {
+		attrs = append(attrs, slog.String("pseudo_status", info.PseudoStatus))
+	}
+	if info.Panicked {
+		level = slog.LevelError
+	}
+	if info.RoutePattern != "" {
+		attrs = append(attrs, slog.String("route", info.RoutePattern))
+	}
+	if len(info.URLParams) > 0 {
+		params := make([]interface{}, len(info.URLParams))
+		for i, p := range info.URLParams {
+			params[i] = slog.String(p.Key, p.Value)
+		}
+		attrs = append(attrs, slog.Group("url_params", params...))
+	}
+	if info.ClientClosed {
+		attrs = append(attrs, slog.Bool("client_closed", true))
+	}
+	if info.WriteErrors > 0 {
+		attrs = append(attrs, slog.Int("write_errors", info.WriteErrors), slog.Any("write_error", info.WriteError))
+	}
+	if ttfb := info.TimeToFirstByte(); ttfb > 0 {
+		attrs = append(attrs, slog.Duration("ttfb", ttfb))
+	}
+	if info.ContentType != "" {
+		attrs = append(attrs, slog.String("content_type", info.ContentType))
+	}
+	if info.ContentEncoding != "" {
+		attrs = append(attrs, slog.String("content_encoding", info.ContentEncoding))
+	}
+	if info.RequestBody != nil {
+		attrs = append(attrs, capturedBodyAttr("request_body", info.RequestBody.redacted(l.redactor)))
+	}
+	if info.ResponseBody != nil {
+		attrs = append(attrs, capturedBodyAttr("response_body", info.ResponseBody.redacted(l.redactor)))
+	}
+	l.log(level, "request", attrs...)
+}
+
+func (l slogLogEntry) WithLogger(logger LoggerInterface) LogEntry {
+	l.handler = nil
+	l.logger = slog.New(slog.NewTextHandler(loggerWriter{logger}, nil))
+	return &l
+}
+
+// WriteStart logs the "request started" message.
+func (l *slogLogEntry) WriteStart() {
+	l.log(slog.LevelInfo, "request started")
+}
+
+// WriteRunning logs the "request still running" warning.
+func (l *slogLogEntry) WriteRunning(elapsed time.Duration) {
+	l.log(slog.LevelWarn, "request still running", slog.Duration("elapsed", elapsed))
+}
+
+// SetField sets the key/value attribute of the access line.
+func (l *slogLogEntry) SetField(key string, value interface{}) {
+	l.attrs.set(slog.Any(key, value))
+}
+
+// Enabled implements slog.Handler.
+func (l *slogLogEntry) Enabled(ctx context.Context, level slog.Level) bool {
+	return l.logger.Handler().Enabled(ctx, level)
+}
+
+func (l *slogLogEntry) slogHandler() slog.Handler {
+	if l.handler == nil {
+		return l.logger.Handler().WithAttrs(l.requestAttrs())
+	}
+	return l.handler
+}
+
+// Handle implements slog.Handler. The record is written by the formatter
+// logger with the request attributes.
+func (l *slogLogEntry) Handle(ctx context.Context, rec slog.Record) error {
+	return l.slogHandler().Handle(ctx, rec)
+}
+
+// WithAttrs implements slog.Handler. The attributes are also set to the
+// entry like SetField, so they are written once on the final access line.
+func (l *slogLogEntry) WithAttrs(attrs []slog.Attr) slog.Handler {
+	c := *l
+	c.handler = l.slogHandler().WithAttrs(attrs)
+	for i := len(l.groups) - 1; i >= 0; i-- {
+		attrs = []slog.Attr{{Key: l.groups[i], Value: slog.GroupValue(attrs...)}}
+	}
+	l.attrs.set(attrs...)
+	return &c
+}
+
+// WithGroup implements slog.Handler.
+func (l *slogLogEntry) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return l
+	}
+	c := *l
+	c.handler = l.slogHandler().WithGroup(name)
+	c.groups = append(append([]string(nil), l.groups...), name)
+	return &c
+}
+
+func capturedBodyAttr(key string, body *CapturedBody) slog.Attr {
+	return slog.Group(key,
+		slog.String("content_type", body.ContentType),
+		slog.String("data", string(body.Data)),
+		slog.Int("size", body.Size),
+		slog.Bool("truncated", body.Truncated))
+}
+
+type slogPanicEntry struct {
+	slogLogEntry
+}
+
+func (l *slogPanicEntry) Write(v interface{}, stackb []byte) {
+	attrs := []slog.Attr{slog.String("panic", l.redactor.String(fmt.Sprintf("%+v", v)))}
+	if buckets, err := ParseStack(stackb); err == nil {
+		attrs = append(attrs, slog.Any("frames", StackFrames(buckets)))
+	} else {
+		attrs = append(attrs, slog.String("stack", l.redactor.String(string(stackb))))
+	}
+	l.log(slog.LevelError, "panic", attrs...)
+}
+
+func (l slogPanicEntry) WithLogger(logger LoggerInterface) PanicEntry {
+	l.handler = nil
+	l.logger = slog.New(slog.NewTextHandler(loggerWriter{logger}, nil))
+	return &l
+}
+
+// loggerWriter is an io.Writer that prints each write to the logger.
+type loggerWriter struct {
+	LoggerInterface
+}
+
+func (w loggerWriter) Write(p []byte) (int, error) {
+	w.Print(strings.TrimSuffix(string(p), "\n"))
+	return len(p), nil
+}
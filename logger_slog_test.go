@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// slogRecords returns the JSON records written by the slog handler.
+func slogRecords(t *testing.T, out *bytes.Buffer) (records []map[string]interface{}) {
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var rec map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &rec); err != nil {
+			t.Fatalf("%v: %s", err, line)
+		}
+		records = append(records, rec)
+	}
+	return
+}
+
+func TestSlogLogFormatter_Level(t *testing.T) {
+	tests := []struct {
+		status int
+		level  string
+	}{
+		{http.StatusOK, "INFO"},
+		{http.StatusFound, "INFO"},
+		{http.StatusNotFound, "WARN"},
+		{http.StatusServiceUnavailable, "ERROR"},
+	}
+	for _, tt := range tests {
+		var out bytes.Buffer
+		f := NewSlogLogFormatter(slog.New(slog.NewJSONHandler(&out, nil)))
+		RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(tt.status)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		rec := slogRecords(t, &out)[0]
+		if rec["level"] != tt.level || rec["status"] != float64(tt.status) {
+			t.Errorf("%d: got level %v status %v", tt.status, rec["level"], rec["status"])
+		}
+	}
+}
+
+func TestSlogLogFormatter_Panic(t *testing.T) {
+	var out bytes.Buffer
+	f := NewSlogLogFormatter(slog.New(slog.NewJSONHandler(&out, nil)))
+	h := RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic("boom")
+	}))
+	func() {
+		defer func() { recover() }()
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	}()
+	if rec := slogRecords(t, &out)[0]; rec["level"] != "ERROR" || rec["status"] != float64(200) {
+		t.Errorf("panicked request: got %v", rec)
+	}
+
+	out.Reset()
+	f.NewPanicEntry(httptest.NewRequest("GET", "/", nil)).Write("boom", []byte("not a stack"))
+	if rec := slogRecords(t, &out)[0]; rec["level"] != "ERROR" || rec["msg"] != "panic" || rec["panic"] != "boom" {
+		t.Errorf("panic entry: got %v", rec)
+	}
+}
+
+func TestSlogLogFormatter_HandlerAttrs(t *testing.T) {
+	var out bytes.Buffer
+	f := NewSlogLogFormatter(slog.New(slog.NewJSONHandler(&out, nil)))
+	RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logger := GetSlogLogger(r)
+		for i := 0; i < 3; i++ {
+			logger.With("item", i).Info("item loaded")
+		}
+		logger.WithGroup("user").With("id", 1).With("name", "a").Info("user loaded")
+		SetLogField(r, "k", "v")
+	})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	records := slogRecords(t, &out)
+	if len(records) != 5 {
+		t.Fatalf("got %d records", len(records))
+	}
+	if records[1]["item"] != float64(1) || records[0]["method"] != "GET" {
+		t.Errorf("handler record: got %v", records[1])
+	}
+	access := records[4]
+	if access["msg"] != "request" || access["item"] != float64(2) || access["k"] != "v" {
+		t.Errorf("access line: got %v", access)
+	}
+	if user, _ := access["user"].(map[string]interface{}); user["id"] != float64(1) || user["name"] != "a" {
+		t.Errorf("access line group: got %v", access["user"])
+	}
+	if n := strings.Count(out.String()[strings.LastIndex(out.String(), `"msg":"request"`):], `"item"`); n != 1 {
+		t.Errorf("item written %d times on the access line", n)
+	}
+}
+
+func TestSlogLogFormatter_Route(t *testing.T) {
+	var out bytes.Buffer
+	f := NewSlogLogFormatter(slog.New(slog.NewJSONHandler(&out, nil)))
+	routeTestRouter(RequestLogger(f)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/5", nil))
+
+	rec := slogRecords(t, &out)[0]
+	params, _ := rec["url_params"].(map[string]interface{})
+	if rec["route"] != "/users/{id}" || len(params) != 1 || params["id"] != "5" {
+		t.Errorf("got route %v and params %v", rec["route"], rec["url_params"])
+	}
+}
@@ -1,7 +1,11 @@
 package middleware
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"regexp"
 	"strings"
 
 	"github.com/maruel/panicparse/stack"
@@ -119,12 +123,7 @@ func (p *StackPalette) StackLines(signature *stack.Signature, srcLen, pkgLen int
 	var out []string
 	for i := range signature.Stack.Calls {
 		call := &signature.Stack.Calls[i]
-		switch call.Func.Raw {
-		case "runtime/debug.Stack",
-			"github.com/moisespsena-go/tracederror.New",
-			"github.com/moisespsena-go/tracederror.Wrap",
-			"github.com/moisespsena-go/tracederror.Traced",
-			"github.com/moisespsena-go/tracederror.TracedWrap":
+		if skipStackCall(call) {
 			continue
 		}
 		out = append(out, p.callLine(call, srcLen, pkgLen, fullPath))
@@ -135,6 +134,74 @@ func (p *StackPalette) StackLines(signature *stack.Signature, srcLen, pkgLen int
 	return strings.Join(out, "\n") + "\n"
 }
 
+// skipStackCall reports whether the call only records the trace itself.
+func skipStackCall(call *stack.Call) bool {
+	switch call.Func.Raw {
+	case "runtime/debug.Stack",
+		"github.com/moisespsena-go/tracederror.New",
+		"github.com/moisespsena-go/tracederror.Wrap",
+		"github.com/moisespsena-go/tracederror.Traced",
+		"github.com/moisespsena-go/tracederror.TracedWrap":
+		return true
+	}
+	return false
+}
+
+var (
+	stackArgsFixer      = strings.NewReplacer("{", "", "}", "", "?", "")
+	stackArgsRegexp     = regexp.MustCompile(`(?m)\([^()\n]*[{?][^()\n]*\)$`)
+	stackCreatedByRegex = regexp.MustCompile(`(?m)^(created by .+) in goroutine \d+$`)
+)
+
+// normalizeStack rewrites the call arguments and creator lines of recent Go
+// releases (`f({0x1?, 0x2})`, `created by f in goroutine 1`) to the format
+// understood by panicparse.
+func normalizeStack(stackb []byte) []byte {
+	stackb = stackArgsRegexp.ReplaceAllFunc(stackb, func(args []byte) []byte {
+		return []byte(stackArgsFixer.Replace(string(args)))
+	})
+	return stackCreatedByRegex.ReplaceAll(stackb, []byte("$1"))
+}
+
+// ParseStack parses a stack dump (as returned by debug.Stack) into buckets.
+func ParseStack(stackb []byte) ([]*stack.Bucket, error) {
+	c, err := stack.ParseDump(bytes.NewReader(normalizeStack(stackb)), ioutil.Discard, false)
+	if err != nil {
+		return nil, err
+	}
+	if c == nil {
+		return nil, errors.New("no goroutine found in stack")
+	}
+	return stack.Aggregate(c.Goroutines, stack.AnyValue), nil
+}
+
+// StackFrame is one call of a parsed stack trace.
+type StackFrame struct {
+	Func string `json:"func"`
+	Pkg  string `json:"pkg"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+}
+
+// StackFrames returns the calls of the buckets as a flat frame list.
+func StackFrames(buckets []*stack.Bucket) (frames []StackFrame) {
+	for _, bucket := range buckets {
+		for i := range bucket.Signature.Stack.Calls {
+			call := &bucket.Signature.Stack.Calls[i]
+			if skipStackCall(call) {
+				continue
+			}
+			frames = append(frames, StackFrame{
+				Func: call.Func.Raw,
+				Pkg:  call.Func.PkgName(),
+				File: call.SrcPath,
+				Line: call.Line,
+			})
+		}
+	}
+	return
+}
+
 // resetFG is similar to ansi.Reset except that it doesn't reset the
 // background color, only the foreground color and the style.
 //
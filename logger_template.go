@@ -0,0 +1,434 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+const (
+	// CommonLogFormat is the TemplateLogFormatter format of the Common Log Format.
+	CommonLogFormat = `%h %l %u %t "%r" %>s %b`
+	// CombinedLogFormat is the TemplateLogFormatter format of the Combined Log Format.
+	CombinedLogFormat = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-Agent}i"`
+)
+
+// TemplateLogFormatter is a LogFormatter that writes lines using a format
+// string like Apache LogFormat. The format is compiled once by
+// NewTemplateLogFormatter.
+//
+// Directives:
+//
+//	%%          the percent sign
+//	%a, %h      the real client IP (see GetRealIP)
+//	%{c}a       the connection peer IP
+//	%l          "-" (remote logname)
+//	%u          the remote user (URL or basic auth)
+//	%t          the request time in Common Log Format
+//	%{layout}t  the request time formatted with the Go time layout
+//	%r          the request line
+//	%m          the request method
+//	%U          the URL path
+//	%q          the query string, prefixed with "?" if not empty
+//	%{name}q    the query param value
+//	%H          the request protocol
+//	%v          the request host
+//	%s, %>s     the response status
+//	%{pseudo}s  the response pseudo status (see ResponseInfo.PseudoStatus) or status
+//	%b          the response size, or "-" if zero
+//	%B          the response size
+//	%D          the elapsed time in microseconds
+//	%T          the elapsed time in seconds
+//	%{unit}T    the elapsed time in unit: ns, us, ms or s
+//	%^FB        the time to first byte in microseconds
+//	%{unit}^FB  the time to first byte in unit: ns, us, ms or s
+//	%X          "X" if the client closed the request, otherwise "+"
+//	%R          the chi route pattern (see RoutePattern)
+//	%{name}R    the chi URL param value
+//	%L          the request ID (see chi middleware.RequestID)
+//	%{trace}L   the trace ID (see TraceParent)
+//	%{span}L    the span ID (see TraceParent)
+//	%{name}i    the request header value
+//	%{name}o    the response header value
+//	%{name}C    the request cookie value
+//	%F          the per-request fields as key=value pairs (see SetLogField)
+//	%{key}F     the per-request field value
+//
+// Empty values are written as "-".
+type TemplateLogFormatter struct {
+	LogFormatterConfig
+	Logger LoggerInterface
+
+	format   string
+	segments []templateSegment
+}
+
+// templateSegment appends one compiled directive to the line.
+type templateSegment func(buf []byte, e *templateLogEntry) []byte
+
+// NewTemplateLogFormatter create request logger using the format. Returns
+// error if format has invalid directives.
+func NewTemplateLogFormatter(format string, out io.Writer, ignore ...Extensions) (*TemplateLogFormatter, error) {
+	segments, err := compileLogTemplate(format)
+	if err != nil {
+		return nil, err
+	}
+	return &TemplateLogFormatter{
+		LogFormatterConfig: newLogFormatterConfig(ignore...),
+		Logger:             log.New(out, "", 0),
+		format:             format,
+		segments:           segments,
+	}, nil
+}
+
+// MustTemplateLogFormatter is like NewTemplateLogFormatter but panics on
+// invalid format.
+func MustTemplateLogFormatter(format string, out io.Writer, ignore ...Extensions) *TemplateLogFormatter {
+	f, err := NewTemplateLogFormatter(format, out, ignore...)
+	if err != nil {
+		panic(err)
+	}
+	return f
+}
+
+// Format returns the format string.
+func (l *TemplateLogFormatter) Format() string {
+	return l.format
+}
+
+// NewLogEntry creates a new LogEntry for the request.
+func (l *TemplateLogFormatter) NewLogEntry(r *http.Request) LogEntry {
+	return &templateLogEntry{
+		TemplateLogFormatter: l,
+		logger:               l.Logger,
+		request:              r,
+		start:                time.Now(),
+		fields:               &LogFields{},
+		redactor:             l.redactor(),
+	}
+}
+
+type templateLogEntry struct {
+	*TemplateLogFormatter
+	logger   LoggerInterface
+	request  *http.Request
+	start    time.Time
+	fields   *LogFields
+	redactor *Redactor
+
+	info *ResponseInfo
+}
+
+func (l *templateLogEntry) Write(status, bytes int, elapsed time.Duration) {
+	l.WriteResponse(&ResponseInfo{Status: status, Bytes: bytes, Elapsed: elapsed, Start: l.start})
+}
+
+func (l *templateLogEntry) WriteResponse(info *ResponseInfo) {
+	l.info = info
+	buf := make([]byte, 0, 256)
+	for _, s := range l.segments {
+		buf = s(buf, l)
+	}
+	l.logger.Print(string(buf))
+}
+
+func (l templateLogEntry) WithLogger(logger LoggerInterface) LogEntry {
+	l.logger = logger
+	return &l
+}
+
+// SetField sets the key/value written by the %F and %{key}F directives.
+func (l *templateLogEntry) SetField(key string, value interface{}) {
+	l.fields.Set(key, value)
+}
+
+func compileLogTemplate(format string) (segments []templateSegment, err error) {
+	var literal []byte
+	flush := func() {
+		if len(literal) > 0 {
+			s := string(literal)
+			segments = append(segments, func(buf []byte, _ *templateLogEntry) []byte {
+				return append(buf, s...)
+			})
+			literal = nil
+		}
+	}
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			literal = append(literal, format[i])
+			continue
+		}
+		start := i
+		if i++; i == len(format) {
+			return nil, fmt.Errorf("log template: incomplete directive at %d", start)
+		}
+		if format[i] == '%' {
+			literal = append(literal, '%')
+			continue
+		}
+		var arg string
+		if format[i] == '{' {
+			end := i + 1
+			for end < len(format) && format[end] != '}' {
+				end++
+			}
+			if end == len(format) {
+				return nil, fmt.Errorf("log template: unclosed '{' at %d", i)
+			}
+			arg, i = format[i+1:end], end+1
+		}
+		for i < len(format) && (format[i] == '>' || format[i] == '<') {
+			i++
+		}
+		if i == len(format) {
+			return nil, fmt.Errorf("log template: incomplete directive at %d", start)
+		}
+		directive := format[i]
+		if directive == '^' {
+			if !strings.HasPrefix(format[i:], "^FB") {
+				return nil, fmt.Errorf("log template: unknown directive at %d", start)
+			}
+			i += 2
+		}
+		segment, err := compileLogDirective(directive, arg)
+		if err != nil {
+			return nil, fmt.Errorf("log template: directive %q: %v", format[start:i+1], err)
+		}
+		flush()
+		segments = append(segments, segment)
+	}
+	flush()
+	return
+}
+
+func compileLogDirective(directive byte, arg string) (templateSegment, error) {
+	switch directive {
+	case 'a':
+		if arg == "c" {
+			return func(buf []byte, e *templateLogEntry) []byte {
+				host, _, err := net.SplitHostPort(e.request.RemoteAddr)
+				if err != nil {
+					host = e.request.RemoteAddr
+				}
+				return appendCommonLogValue(buf, host)
+			}, nil
+		}
+		return logStringDirective(GetRealIP), nil
+	case 'h':
+		return logStringDirective(GetRealIP), nil
+	case 'l':
+		return logStringDirective(func(*http.Request) string { return "" }), nil
+	case 'u':
+		return logStringDirective(requestUsername), nil
+	case 't':
+		layout := arg
+		if layout == "" {
+			layout = "[" + CommonLogTimeFormat + "]"
+		}
+		return func(buf []byte, e *templateLogEntry) []byte {
+			return e.start.AppendFormat(buf, layout)
+		}, nil
+	case 'r':
+		return func(buf []byte, e *templateLogEntry) []byte {
+			buf = appendCommonLogEscaped(buf, e.request.Method)
+			buf = append(buf, ' ')
+			buf = appendCommonLogEscaped(buf, e.redactor.URI(e.request.RequestURI))
+			buf = append(buf, ' ')
+			return appendCommonLogEscaped(buf, e.request.Proto)
+		}, nil
+	case 'm':
+		return logStringDirective(func(r *http.Request) string { return r.Method }), nil
+	case 'U':
+		return logStringDirective(func(r *http.Request) string { return r.URL.Path }), nil
+	case 'q':
+		if arg != "" {
+			return func(buf []byte, e *templateLogEntry) []byte {
+				return appendCommonLogValue(buf, e.redactor.QueryParam(arg, e.request.URL.Query().Get(arg)))
+			}, nil
+		}
+		return func(buf []byte, e *templateLogEntry) []byte {
+			if q := e.request.URL.RawQuery; q != "" {
+				buf = appendCommonLogEscaped(buf, e.redactor.URI("?"+q))
+			}
+			return buf
+		}, nil
+	case 'H':
+		return logStringDirective(func(r *http.Request) string { return r.Proto }), nil
+	case 'v':
+		return logStringDirective(func(r *http.Request) string { return r.Host }), nil
+	case 's':
+		if arg == "pseudo" {
+			return func(buf []byte, e *templateLogEntry) []byte {
+				if e.info.PseudoStatus != "" {
+					return append(buf, e.info.PseudoStatus...)
+				}
+				return strconv.AppendInt(buf, int64(e.info.Status), 10)
+			}, nil
+		} else if arg != "" {
+			return nil, fmt.Errorf("invalid status argument %q", arg)
+		}
+		return func(buf []byte, e *templateLogEntry) []byte {
+			return strconv.AppendInt(buf, int64(e.info.Status), 10)
+		}, nil
+	case 'b':
+		return func(buf []byte, e *templateLogEntry) []byte {
+			if e.info.Bytes == 0 {
+				return append(buf, '-')
+			}
+			return strconv.AppendInt(buf, int64(e.info.Bytes), 10)
+		}, nil
+	case 'B':
+		return func(buf []byte, e *templateLogEntry) []byte {
+			return strconv.AppendInt(buf, int64(e.info.Bytes), 10)
+		}, nil
+	case 'D':
+		return logElapsedDirective(time.Microsecond), nil
+	case 'T':
+		unit, err := durationUnit(arg, time.Second)
+		if err != nil {
+			return nil, err
+		}
+		return logElapsedDirective(unit), nil
+	case '^':
+		unit, err := durationUnit(arg, time.Microsecond)
+		if err != nil {
+			return nil, err
+		}
+		return logDurationDirective(unit, (*ResponseInfo).TimeToFirstByte), nil
+	case 'X':
+		return func(buf []byte, e *templateLogEntry) []byte {
+			if e.info.ClientClosed {
+				return append(buf, 'X')
+			}
+			return append(buf, '+')
+		}, nil
+	case 'R':
+		if arg != "" {
+			return func(buf []byte, e *templateLogEntry) []byte {
+				for _, p := range e.info.URLParams {
+					if p.Key == arg {
+						return appendCommonLogValue(buf, p.Value)
+					}
+				}
+				return append(buf, '-')
+			}, nil
+		}
+		return func(buf []byte, e *templateLogEntry) []byte {
+			return appendCommonLogValue(buf, e.info.RoutePattern)
+		}, nil
+	case 'L':
+		switch arg {
+		case "":
+			return logStringDirective(func(r *http.Request) string { return middleware.GetReqID(r.Context()) }), nil
+		case "trace":
+			return logStringDirective(func(r *http.Request) string { return GetTraceID(r.Context()) }), nil
+		case "span":
+			return logStringDirective(func(r *http.Request) string { return GetSpanID(r.Context()) }), nil
+		default:
+			return nil, fmt.Errorf("unknown log ID %q", arg)
+		}
+	case 'i':
+		if arg == "" {
+			return nil, fmt.Errorf("header name is required")
+		}
+		return func(buf []byte, e *templateLogEntry) []byte {
+			return appendCommonLogValue(buf, e.redactor.Header(arg, e.request.Header.Get(arg)))
+		}, nil
+	case 'o':
+		if arg == "" {
+			return nil, fmt.Errorf("header name is required")
+		}
+		return func(buf []byte, e *templateLogEntry) []byte {
+			return appendCommonLogValue(buf, e.redactor.Header(arg, e.info.Header.Get(arg)))
+		}, nil
+	case 'C':
+		if arg == "" {
+			return nil, fmt.Errorf("cookie name is required")
+		}
+		return func(buf []byte, e *templateLogEntry) []byte {
+			if c, err := e.request.Cookie(arg); err == nil {
+				return appendCommonLogValue(buf, e.redactor.Cookie(arg, c.Value))
+			}
+			return append(buf, '-')
+		}, nil
+	case 'F':
+		if arg != "" {
+			return func(buf []byte, e *templateLogEntry) []byte {
+				for _, field := range e.fields.Fields() {
+					if field.Key == arg {
+						return appendCommonLogValue(buf, fmt.Sprint(field.Value))
+					}
+				}
+				return append(buf, '-')
+			}, nil
+		}
+		return func(buf []byte, e *templateLogEntry) []byte {
+			w := appendWriter{buf}
+			writeLogFields(&w, e.fields.Fields())
+			if len(w.buf) > len(buf) {
+				// skip the leading space
+				return append(buf, w.buf[len(buf)+1:]...)
+			}
+			return append(buf, '-')
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown directive")
+}
+
+// logStringDirective returns a segment that appends the escaped request value.
+func logStringDirective(get func(r *http.Request) string) templateSegment {
+	return func(buf []byte, e *templateLogEntry) []byte {
+		return appendCommonLogValue(buf, get(e.request))
+	}
+}
+
+// logElapsedDirective returns a segment that appends the elapsed time in unit.
+func logElapsedDirective(unit time.Duration) templateSegment {
+	return logDurationDirective(unit, func(info *ResponseInfo) time.Duration { return info.Elapsed })
+}
+
+// logDurationDirective returns a segment that appends the duration in unit.
+func logDurationDirective(unit time.Duration, get func(info *ResponseInfo) time.Duration) templateSegment {
+	if unit == time.Second || unit == time.Millisecond {
+		return func(buf []byte, e *templateLogEntry) []byte {
+			return strconv.AppendFloat(buf, float64(get(e.info))/float64(unit), 'f', 3, 64)
+		}
+	}
+	return func(buf []byte, e *templateLogEntry) []byte {
+		return strconv.AppendInt(buf, int64(get(e.info)/unit), 10)
+	}
+}
+
+// durationUnit returns the unit of the name ("", s, ms, us or ns).
+func durationUnit(name string, def time.Duration) (time.Duration, error) {
+	switch name {
+	case "":
+		return def, nil
+	case "s":
+		return time.Second, nil
+	case "ms":
+		return time.Millisecond, nil
+	case "us":
+		return time.Microsecond, nil
+	case "ns":
+		return time.Nanosecond, nil
+	}
+	return 0, fmt.Errorf("invalid time unit %q", name)
+}
+
+// appendWriter is an io.Writer that appends to buf.
+type appendWriter struct {
+	buf []byte
+}
+
+func (w *appendWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	return len(p), nil
+}
@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestTemplateLogFormatter(t *testing.T) {
+	tests := []struct {
+		name, format, want string
+	}{
+		{"request", `%a %m %U%q %H %v`, "10.0.0.1 GET /a?q=1&b=2 HTTP/1.1 example.com\n"},
+		{"values", `%{q}q %{X-In}i %{X-Out}o %{c}C %{missing}i`, "1 in out cv -\n"},
+		{"response", `%>s %b %B 100%%`, "201 5 5 100%\n"},
+		{"fields", `%F|%{k}F`, `k=v n="a b"|v` + "\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			f, err := NewTemplateLogFormatter(tt.format, &out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			h := RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				SetLogField(r, "k", "v")
+				SetLogField(r, "n", "a b")
+				w.Header().Set("X-Out", "out")
+				w.WriteHeader(http.StatusCreated)
+				w.Write([]byte("hello"))
+			}))
+			r := httptest.NewRequest("GET", "/a?q=1&b=2", nil)
+			r.Header.Set("X-Forwarded-For", "10.0.0.1")
+			r.Header.Set("X-In", "in")
+			r.AddCookie(&http.Cookie{Name: "c", Value: "cv"})
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got := out.String(); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateLogFormatter_Invalid(t *testing.T) {
+	for _, format := range []string{"%", "%{x", "%Z", "%{h}T", "%i"} {
+		if _, err := NewTemplateLogFormatter(format, nil); err == nil {
+			t.Errorf("%q: expected error", format)
+		}
+	}
+}
+
+func TestTemplateLogFormatter_Route(t *testing.T) {
+	var out bytes.Buffer
+	m := chi.NewRouter()
+	m.Use(RequestLogger(MustTemplateLogFormatter(`%R %{id}R %{x}R`, &out), &RequestLoggerOpts{IgnoreRoutes: []string{"/health"}}))
+	m.Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+	m.Route("/users", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/health", nil))
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/5", nil))
+	if got, want := out.String(), "/users/{id} 5 -\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,137 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+func TestDefaultLogAndPanicFormatter_Colors(t *testing.T) {
+	var out bytes.Buffer
+	f := NewDefaultRequestLogFormatter(&out, &out, "")
+	f.NoColorTtyCheck = true
+	f.LatencyBands = []LatencyBand{{time.Hour, Color("magenta")}}
+	f.StatusColors = map[int][]byte{http.StatusCreated: Color("cyan")}
+
+	for _, status := range []int{http.StatusCreated, http.StatusNotFound} {
+		out.Reset()
+		RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		})).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		line := out.String()
+		if want := string(Color("magenta")); !strings.Contains(line, want) {
+			t.Errorf("%d: latency color %q not found in %q", status, want, line)
+		}
+		want := string(bYellow) + "404"
+		if status == http.StatusCreated {
+			want = string(Color("cyan")) + "201"
+		}
+		if !strings.Contains(line, want) {
+			t.Errorf("%d: %q not found in %q", status, want, line)
+		}
+	}
+}
+
+func TestDefaultLogAndPanicFormatter_Slow(t *testing.T) {
+	for _, withSlowLogger := range []bool{true, false} {
+		var access, panics, slow bytes.Buffer
+		f := NewDefaultRequestLogFormatter(&access, &panics, "")
+		if withSlowLogger {
+			f.SlowLogger = log.New(&slow, "", 0)
+		}
+		f.NoColor = true
+		f.SlowThreshold = 10 * time.Millisecond
+		h := RequestLogger(f)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/slow" {
+				time.Sleep(20 * time.Millisecond)
+			}
+		}))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/fast", nil))
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/slow", nil))
+
+		slowOut := &panics
+		if withSlowLogger {
+			slowOut = &slow
+		}
+		if got := access.String(); !strings.Contains(got, "/fast") || strings.Contains(got, "/slow") || strings.Contains(got, "SLOW") {
+			t.Errorf("slow logger %v: got access %q", withSlowLogger, got)
+		}
+		if got := slowOut.String(); !strings.Contains(got, "/slow") || !strings.Contains(got, " SLOW") {
+			t.Errorf("slow logger %v: got slow %q", withSlowLogger, got)
+		}
+	}
+}
+
+func TestRequestLogger_Filter(t *testing.T) {
+	var out bytes.Buffer
+	h := RequestLogger(NewCommonLogFormatter(&out), &RequestLoggerOpts{Filter: FilterFailed(400)})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.png" {
+			http.NotFound(w, r)
+		}
+	}))
+	for _, target := range []string{"/ok.png", "/missing.png", "/page"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+	got := out.String()
+	if strings.Contains(got, "/ok.png") || !strings.Contains(got, "/missing.png") || !strings.Contains(got, "/page") {
+		t.Errorf("unexpected log: %q", got)
+	}
+}
+
+// routeTestRouter returns a chi router with the /health and the /users/{id}
+// subrouter routes, using the middleware.
+func routeTestRouter(mw func(http.Handler) http.Handler) chi.Router {
+	m := chi.NewRouter()
+	m.Use(mw)
+	m.Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+	m.Route("/users", func(r chi.Router) {
+		r.Get("/{id}", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	return m
+}
+
+func TestDefaultLogAndPanicFormatter_Route(t *testing.T) {
+	tests := []struct {
+		name              string
+		route, params     bool
+		want, notExpected string
+	}{
+		{"route", true, false, " route=/users/{id}", "param.id"},
+		{"params", false, true, " param.id=5", "route="},
+		{"both", true, true, " route=/users/{id} param.id=5", ""},
+		{"none", false, false, "", "route="},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			f := NewDefaultRequestLogFormatter(&out, &out, "")
+			f.NoColor = true
+			f.LogRoute, f.LogURLParams = tt.route, tt.params
+			routeTestRouter(RequestLogger(f)).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/users/5", nil))
+			got := out.String()
+			if !strings.Contains(got, tt.want) || (tt.notExpected != "" && strings.Contains(got, tt.notExpected)) {
+				t.Errorf("got %q, want %q without %q", got, tt.want, tt.notExpected)
+			}
+		})
+	}
+}
+
+func TestRequestLogger_IgnoreRoutes(t *testing.T) {
+	var out bytes.Buffer
+	f := NewDefaultRequestLogFormatter(&out, &out, "")
+	f.NoColor = true
+	h := routeTestRouter(RequestLogger(f, &RequestLoggerOpts{IgnoreRoutes: []string{"/health", "/users/{id}"}}))
+	for _, target := range []string{"/health", "/users/5", "/missing"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+	got := out.String()
+	if strings.Contains(got, "/health") || strings.Contains(got, "/users/5") || !strings.Contains(got, "/missing") {
+		t.Errorf("unexpected log: %q", got)
+	}
+}
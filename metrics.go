@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	// DefaultMetricsDurationBuckets is the request duration histogram buckets
+	// in seconds.
+	DefaultMetricsDurationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+	// DefaultMetricsSizeBuckets is the response size histogram buckets in bytes.
+	DefaultMetricsSizeBuckets = []float64{100, 1000, 10000, 100000, 1000000, 10000000}
+)
+
+// MetricsOpts is the Metrics options.
+type MetricsOpts struct {
+	// Namespace prefixes the metric names, like "myapp" for
+	// "myapp_http_requests_total".
+	Namespace string
+	// DurationBuckets default is DefaultMetricsDurationBuckets.
+	DurationBuckets []float64
+	// SizeBuckets default is DefaultMetricsSizeBuckets.
+	SizeBuckets []float64
+}
+
+// Metrics records Prometheus compatible HTTP metrics: the requests count,
+// duration and response size histograms labeled by method, status class and
+// chi route pattern, and the in-flight requests gauge.
+//
+// Use Handler as middleware and serve the Metrics itself as the Prometheus
+// text exposition handler:
+//
+//	metrics := NewMetrics()
+//	r.Use(metrics.Handler)
+//	r.Method("GET", "/metrics", metrics)
+type Metrics struct {
+	namespace       string
+	durationBuckets []float64
+	sizeBuckets     []float64
+	observe         func(next http.Handler) http.Handler
+	inFlight        int64
+
+	mu     sync.Mutex
+	series map[metricsKey]*metricsSeries
+}
+
+type metricsKey struct {
+	method, status, route string
+}
+
+type metricsSeries struct {
+	count     uint64
+	durations metricsHistogram
+	sizes     metricsHistogram
+}
+
+type metricsHistogram struct {
+	counts []uint64
+	sum    float64
+}
+
+func (h *metricsHistogram) observe(buckets []float64, v float64) {
+	if h.counts == nil {
+		h.counts = make([]uint64, len(buckets))
+	}
+	if i := sort.SearchFloat64s(buckets, v); i < len(buckets) {
+		h.counts[i]++
+	}
+	h.sum += v
+}
+
+// NewMetrics creates a new Metrics. Without opts, the metric names have no
+// namespace and the histograms use the default buckets.
+func NewMetrics(opts ...*MetricsOpts) *Metrics {
+	opt := &MetricsOpts{}
+	if len(opts) > 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+	m := &Metrics{
+		durationBuckets: metricsBuckets(opt.DurationBuckets, DefaultMetricsDurationBuckets),
+		sizeBuckets:     metricsBuckets(opt.SizeBuckets, DefaultMetricsSizeBuckets),
+		series:          map[metricsKey]*metricsSeries{},
+	}
+	if opt.Namespace != "" {
+		m.namespace = opt.Namespace + "_"
+	}
+	m.observe = Observe(m.record)
+	return m
+}
+
+func metricsBuckets(buckets, defaults []float64) []float64 {
+	if len(buckets) == 0 {
+		buckets = defaults
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return buckets
+}
+
+// Handler is a middleware that records the request metrics.
+func (this *Metrics) Handler(next http.Handler) http.Handler {
+	next = this.observe(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&this.inFlight, 1)
+		defer atomic.AddInt64(&this.inFlight, -1)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (this *Metrics) record(r *http.Request, info *ResponseInfo) {
+	key := metricsKey{metricsMethod(r.Method), metricsStatusClass(info), info.RoutePattern}
+	this.mu.Lock()
+	defer this.mu.Unlock()
+	s := this.series[key]
+	if s == nil {
+		s = &metricsSeries{}
+		this.series[key] = s
+	}
+	s.count++
+	s.durations.observe(this.durationBuckets, info.Elapsed.Seconds())
+	s.sizes.observe(this.sizeBuckets, float64(info.Bytes))
+}
+
+// metricsMethod returns the method label, limiting the label values to the
+// standard methods.
+func metricsMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	}
+	return "OTHER"
+}
+
+// metricsStatusClass returns the status class label, like "2xx".
+func metricsStatusClass(info *ResponseInfo) string {
+	switch {
+	case info.PseudoStatus == PseudoStatusHijacked:
+		return "hijacked"
+	case info.Status == 0 || info.Panicked:
+		return "5xx"
+	case info.Status < 100 || info.Status > 599:
+		return "other"
+	}
+	return strconv.Itoa(info.Status/100) + "xx"
+}
+
+// InFlight returns the number of requests being served.
+func (this *Metrics) InFlight() int64 {
+	return atomic.LoadInt64(&this.inFlight)
+}
+
+// ServeHTTP serves the metrics in the Prometheus text exposition format.
+func (this *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	this.WriteTo(w)
+}
+
+// WriteTo writes the metrics in the Prometheus text exposition format.
+func (this *Metrics) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	ns := this.namespace
+
+	this.mu.Lock()
+	keys := make([]metricsKey, 0, len(this.series))
+	for key := range this.series {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	series := make([]metricsSeries, len(keys))
+	for i, key := range keys {
+		s := this.series[key]
+		series[i] = metricsSeries{
+			count:     s.count,
+			durations: metricsHistogram{append([]uint64(nil), s.durations.counts...), s.durations.sum},
+			sizes:     metricsHistogram{append([]uint64(nil), s.sizes.counts...), s.sizes.sum},
+		}
+	}
+	this.mu.Unlock()
+
+	fmt.Fprintf(&b, "# HELP %shttp_requests_total Total number of HTTP requests.\n", ns)
+	fmt.Fprintf(&b, "# TYPE %shttp_requests_total counter\n", ns)
+	for i, key := range keys {
+		fmt.Fprintf(&b, "%shttp_requests_total{%s} %d\n", ns, key.labels(), series[i].count)
+	}
+
+	writeHistogram := func(name, help string, buckets []float64, get func(s *metricsSeries) *metricsHistogram) {
+		fmt.Fprintf(&b, "# HELP %s%s %s\n", ns, name, help)
+		fmt.Fprintf(&b, "# TYPE %s%s histogram\n", ns, name)
+		for i, key := range keys {
+			labels, h := key.labels(), get(&series[i])
+			var cumulative uint64
+			for j, le := range buckets {
+				if j < len(h.counts) {
+					cumulative += h.counts[j]
+				}
+				fmt.Fprintf(&b, "%s%s_bucket{%s,le=\"%s\"} %d\n", ns, name, labels, formatMetricsFloat(le), cumulative)
+			}
+			fmt.Fprintf(&b, "%s%s_bucket{%s,le=\"+Inf\"} %d\n", ns, name, labels, series[i].count)
+			fmt.Fprintf(&b, "%s%s_sum{%s} %s\n", ns, name, labels, formatMetricsFloat(h.sum))
+			fmt.Fprintf(&b, "%s%s_count{%s} %d\n", ns, name, labels, series[i].count)
+		}
+	}
+	writeHistogram("http_request_duration_seconds", "HTTP request duration in seconds.", this.durationBuckets,
+		func(s *metricsSeries) *metricsHistogram { return &s.durations })
+	writeHistogram("http_response_size_bytes", "HTTP response body size in bytes.", this.sizeBuckets,
+		func(s *metricsSeries) *metricsHistogram { return &s.sizes })
+
+	fmt.Fprintf(&b, "# HELP %shttp_requests_in_flight Number of HTTP requests being served.\n", ns)
+	fmt.Fprintf(&b, "# TYPE %shttp_requests_in_flight gauge\n", ns)
+	fmt.Fprintf(&b, "%shttp_requests_in_flight %d\n", ns, this.InFlight())
+
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func (k metricsKey) labels() string {
+	return `method="` + k.method + `",route="` + escapeMetricsLabel(k.route) + `",status="` + k.status + `"`
+}
+
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeMetricsLabel(v string) string {
+	return metricsLabelEscaper.Replace(v)
+}
+
+func formatMetricsFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,45 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+)
+
+func TestMetrics(t *testing.T) {
+	metrics := NewMetrics(&MetricsOpts{Namespace: "app", DurationBuckets: []float64{10}, SizeBuckets: []float64{1, 10}})
+	m := chi.NewRouter()
+	m.Use(metrics.Handler)
+	m.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if inFlight := metrics.InFlight(); inFlight != 1 {
+			t.Errorf("in flight: got %d", inFlight)
+		}
+		w.Write([]byte("hello"))
+	})
+	for _, target := range []string{"/users/1", "/users/2", "/missing"} {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	got := w.Body.String()
+	for _, want := range []string{
+		"# TYPE app_http_requests_total counter\n",
+		`app_http_requests_total{method="GET",route="/users/{id}",status="2xx"} 2` + "\n",
+		`app_http_requests_total{method="GET",route="",status="4xx"} 1` + "\n",
+		`app_http_request_duration_seconds_bucket{method="GET",route="/users/{id}",status="2xx",le="10"} 2` + "\n",
+		`app_http_request_duration_seconds_count{method="GET",route="/users/{id}",status="2xx"} 2` + "\n",
+		`app_http_response_size_bytes_bucket{method="GET",route="/users/{id}",status="2xx",le="1"} 0` + "\n",
+		`app_http_response_size_bytes_bucket{method="GET",route="/users/{id}",status="2xx",le="10"} 2` + "\n",
+		`app_http_response_size_bytes_bucket{method="GET",route="/users/{id}",status="2xx",le="+Inf"} 2` + "\n",
+		`app_http_response_size_bytes_sum{method="GET",route="/users/{id}",status="2xx"} 10` + "\n",
+		"app_http_requests_in_flight 0\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("missing %q in:\n%s", want, got)
+		}
+	}
+}
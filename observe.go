@@ -0,0 +1,66 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// PanicObserverCtxKey is the key that holds the request panic observers.
+var PanicObserverCtxKey = &contextKey{"PanicObserver"}
+
+// Observe returns a middleware that calls fn with the response info of each
+// request, after the handler returns or panics. It records the same data as
+// RequestLogger, for metrics and tracing.
+func Observe(fn func(r *http.Request, info *ResponseInfo)) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				ww, rec   = newResponseRecorder(w)
+				t1        = time.Now()
+				completed bool
+			)
+			stopWatch := rec.watchClient(r.Context())
+			defer func() {
+				stopWatch()
+				info := rec.Info(t1)
+				info.Panicked = !completed
+				info.RoutePattern, info.URLParams = RoutePattern(r), URLParams(r)
+				if info.Status == 0 {
+					info.setPseudoStatus(rec.hijacked)
+				}
+				fn(r, info)
+			}()
+			next.ServeHTTP(ww, r)
+			completed = true
+		})
+	}
+}
+
+// PanicObserver is notified synchronously of the panics recovered by
+// Recoverer, before the response is written.
+type PanicObserver interface {
+	ObservePanic(r *http.Request, v interface{}, stack []byte)
+}
+
+// PanicObserverFunc is a PanicObserver function.
+type PanicObserverFunc func(r *http.Request, v interface{}, stack []byte)
+
+func (f PanicObserverFunc) ObservePanic(r *http.Request, v interface{}, stack []byte) {
+	f(r, v, stack)
+}
+
+// WithPanicObserver adds the panic observer to the request context.
+func WithPanicObserver(r *http.Request, o PanicObserver) *http.Request {
+	observers, _ := r.Context().Value(PanicObserverCtxKey).([]PanicObserver)
+	observers = append(observers[:len(observers):len(observers)], o)
+	return r.WithContext(context.WithValue(r.Context(), PanicObserverCtxKey, observers))
+}
+
+// ObservePanic notifies the in-context panic observers of the request.
+func ObservePanic(r *http.Request, v interface{}, stack []byte) {
+	observers, _ := r.Context().Value(PanicObserverCtxKey).([]PanicObserver)
+	for _, o := range observers {
+		o.ObservePanic(r, v, stack)
+	}
+}
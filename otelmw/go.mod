@@ -0,0 +1,31 @@
+module github.com/moisespsena-go/middleware/otelmw
+
+go 1.21
+
+require (
+	github.com/go-chi/chi v1.5.4
+	github.com/moisespsena-go/middleware v0.1.0
+	go.opentelemetry.io/otel v1.28.0
+	go.opentelemetry.io/otel/sdk v1.28.0
+	go.opentelemetry.io/otel/trace v1.28.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.2 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	github.com/google/uuid v1.6.0 // indirect
+	github.com/maruel/panicparse v1.6.1 // indirect
+	github.com/mattn/go-colorable v0.1.7 // indirect
+	github.com/mattn/go-isatty v0.0.12 // indirect
+	github.com/mgutz/ansi v0.0.0-20200706080929-d51e80ef957d // indirect
+	github.com/moisespsena-go/http-post-limit v0.0.1 // indirect
+	github.com/moisespsena-go/httpu v0.0.2 // indirect
+	github.com/moisespsena-go/logging v0.0.2 // indirect
+	github.com/moisespsena-go/path-helpers v0.0.3 // indirect
+	github.com/moisespsena-go/tracederror v0.0.1 // indirect
+	github.com/phayes/permbits v0.0.0-20190612203442-39d7c581d2ee // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/unapu-go/error-utils v0.0.1 // indirect
+	go.opentelemetry.io/otel/metric v1.28.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+)
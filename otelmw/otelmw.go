@@ -0,0 +1,173 @@
+// Package otelmw creates OpenTelemetry server spans for the requests, using
+// the response data recorded by middleware.Observe and the panics recovered
+// by middleware.Recoverer. It is a separate module, so the middleware module
+// does not depend on OpenTelemetry. To develop both modules together, use a
+// local (not committed) go.work in the repository root:
+//
+//	go work init . ./otelmw
+//	go work edit -replace github.com/moisespsena-go/middleware@v0.1.0=./
+package otelmw
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/moisespsena-go/middleware"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ScopeName is the instrumentation scope name of the tracer.
+const ScopeName = "github.com/moisespsena-go/middleware/otelmw"
+
+// Opts is the Middleware options.
+type Opts struct {
+	// TracerProvider defaults to otel.GetTracerProvider().
+	TracerProvider trace.TracerProvider
+	// Propagator defaults to otel.GetTextMapPropagator().
+	Propagator propagation.TextMapPropagator
+	// Redactor masks the span URL and the panic message and stack. Default is
+	// middleware.DefaultRedactor.
+	Redactor *middleware.Redactor
+}
+
+// Middleware returns a middleware that creates a server span per request,
+// in the same middleware position as middleware.RequestLogger. The span
+// records the response status, bytes and elapsed time, is named by the chi
+// route pattern, and the panics recovered by an inner middleware.Recoverer
+// are recorded as exception events. The span trace context is also stored
+// as the middleware.TraceContext, so it is written by the loggers. Without
+// opts, the global OpenTelemetry tracer provider and propagator are used.
+func Middleware(opts ...*Opts) func(next http.Handler) http.Handler {
+	opt := &Opts{}
+	if len(opts) > 0 && opts[0] != nil {
+		opt = opts[0]
+	}
+	tp, prop, redactor := opt.TracerProvider, opt.Propagator, opt.Redactor
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	if prop == nil {
+		prop = otel.GetTextMapPropagator()
+	}
+	if redactor == nil {
+		redactor = middleware.DefaultRedactor
+	}
+	tracer := tp.Tracer(ScopeName)
+	observe := middleware.Observe(endSpan)
+
+	return func(next http.Handler) http.Handler {
+		next = observe(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := prop.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, "HTTP "+r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(requestAttrs(r, redactor)...))
+			if sc := span.SpanContext(); sc.IsValid() {
+				ctx = middleware.WithTraceContext(ctx, &middleware.TraceContext{
+					TraceID: sc.TraceID().String(),
+					SpanID:  sc.SpanID().String(),
+					Flags:   sc.TraceFlags().String(),
+					State:   sc.TraceState().String(),
+				})
+			}
+			r = middleware.WithPanicObserver(r.WithContext(ctx), panicRecorder(redactor))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requestAttrs(r *http.Request, redactor *middleware.Redactor) []attribute.KeyValue {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("http.request.method", r.Method),
+		attribute.String("url.scheme", scheme),
+		attribute.String("url.path", redactor.URI(r.URL.Path)),
+		attribute.String("server.address", r.Host),
+		attribute.String("network.protocol.version", fmt.Sprintf("%d.%d", r.ProtoMajor, r.ProtoMinor)),
+		attribute.String("client.address", middleware.GetRealIP(r)),
+	}
+	if r.URL.RawQuery != "" {
+		attrs = append(attrs, attribute.String("url.query", strings.TrimPrefix(redactor.URI("?"+r.URL.RawQuery), "?")))
+	}
+	if ua := r.UserAgent(); ua != "" {
+		attrs = append(attrs, attribute.String("user_agent.original", ua))
+	}
+	return attrs
+}
+
+func endSpan(r *http.Request, info *middleware.ResponseInfo) {
+	span := trace.SpanFromContext(r.Context())
+	if info.RoutePattern != "" {
+		span.SetName(r.Method + " " + info.RoutePattern)
+		span.SetAttributes(attribute.String("http.route", info.RoutePattern))
+	}
+	attrs := []attribute.KeyValue{
+		attribute.Int64("http.response.body.size", int64(info.Bytes)),
+		attribute.Float64("http.server.request.duration", info.Elapsed.Seconds()),
+	}
+	if info.Status != 0 {
+		attrs = append(attrs, attribute.Int("http.response.status_code", info.Status))
+	}
+	if info.PseudoStatus != "" {
+		attrs = append(attrs, attribute.String("http.response.pseudo_status", info.PseudoStatus))
+	}
+	if !info.FirstByte.IsZero() {
+		attrs = append(attrs, attribute.Float64("http.server.time_to_first_byte", info.TimeToFirstByte().Seconds()))
+	}
+	if info.ClientClosed {
+		attrs = append(attrs, attribute.Bool("http.client_closed", true))
+	}
+	span.SetAttributes(attrs...)
+	switch {
+	case info.Panicked:
+		span.SetStatus(codes.Error, middleware.PseudoStatusPanicked)
+	case info.Status >= 500:
+		span.SetStatus(codes.Error, http.StatusText(info.Status))
+	}
+	span.End(trace.WithTimestamp(info.Start.Add(info.Elapsed)))
+}
+
+// panicRecorder returns the panic observer that records the panic as an
+// exception event of the request span.
+func panicRecorder(redactor *middleware.Redactor) middleware.PanicObserverFunc {
+	return func(r *http.Request, v interface{}, stackb []byte) {
+		span := trace.SpanFromContext(r.Context())
+		if !span.IsRecording() {
+			return
+		}
+		typ := "panic"
+		if v != nil {
+			typ = reflect.TypeOf(v).String()
+		}
+		span.AddEvent("exception", trace.WithAttributes(
+			attribute.String("exception.type", typ),
+			attribute.String("exception.message", redactor.String(fmt.Sprint(v))),
+			attribute.String("exception.stacktrace", stackTrace(stackb, redactor)),
+			attribute.Bool("exception.escaped", false),
+		))
+		span.SetStatus(codes.Error, middleware.PseudoStatusPanicked)
+	}
+}
+
+// stackTrace formats the parsed stack frames, or returns the redacted raw
+// stack if it is not parseable.
+func stackTrace(stackb []byte, redactor *middleware.Redactor) string {
+	buckets, err := middleware.ParseStack(stackb)
+	if err != nil {
+		return redactor.String(string(stackb))
+	}
+	var b strings.Builder
+	for _, f := range middleware.StackFrames(buckets) {
+		fmt.Fprintf(&b, "%s\n\t%s:%d\n", f.Func, f.File, f.Line)
+	}
+	return b.String()
+}
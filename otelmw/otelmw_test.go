@@ -0,0 +1,107 @@
+package otelmw
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/moisespsena-go/middleware"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddleware(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	var traceID string
+	m := chi.NewRouter()
+	m.Use(Middleware(&Opts{TracerProvider: tp, Propagator: propagation.TraceContext{}}), middleware.Recoverer())
+	m.Get("/users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		traceID = middleware.GetTraceID(r.Context())
+		w.Write([]byte("hello"))
+	})
+	m.Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	r := httptest.NewRequest("GET", "/users/5", nil)
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	m.ServeHTTP(httptest.NewRecorder(), r)
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/panic", nil))
+
+	spans := exporter.GetSpans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want 2", len(spans))
+	}
+
+	ok := spans[0]
+	if ok.Name != "GET /users/{id}" {
+		t.Errorf("name: got %q", ok.Name)
+	}
+	if got := ok.SpanContext.TraceID().String(); got != "4bf92f3577b34da6a3ce929d0e0e4736" || traceID != got {
+		t.Errorf("trace ID: got %q, in context %q", got, traceID)
+	}
+	if got := ok.Parent.SpanID().String(); got != "00f067aa0ba902b7" {
+		t.Errorf("parent: got %q", got)
+	}
+	attrs := map[string]interface{}{}
+	for _, kv := range ok.Attributes {
+		attrs[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	if attrs["http.response.status_code"] != int64(200) || attrs["http.response.body.size"] != int64(5) || attrs["http.route"] != "/users/{id}" {
+		t.Errorf("unexpected attributes: %v", attrs)
+	}
+
+	failed := spans[1]
+	if failed.Status.Code != codes.Error {
+		t.Errorf("status: got %v", failed.Status)
+	}
+	if len(failed.Events) != 1 || failed.Events[0].Name != "exception" {
+		t.Fatalf("unexpected events: %v", failed.Events)
+	}
+	for _, kv := range failed.Events[0].Attributes {
+		switch kv.Key {
+		case "exception.message":
+			if kv.Value.AsString() != "boom" {
+				t.Errorf("message: got %q", kv.Value.AsString())
+			}
+		case "exception.stacktrace":
+			if !strings.Contains(kv.Value.AsString(), "otelmw.TestMiddleware") {
+				t.Errorf("stacktrace: got %q", kv.Value.AsString())
+			}
+		}
+	}
+}
+
+func TestMiddleware_Redactor(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	defer tp.Shutdown(context.Background())
+
+	redactor := &middleware.Redactor{Patterns: []*regexp.Regexp{regexp.MustCompile(`secret-\d`)}}
+	h := Middleware(&Opts{TracerProvider: tp, Redactor: redactor})(middleware.Recoverer()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("secret-1")
+	})))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	spans := exporter.GetSpans()
+	if len(spans) != 1 || len(spans[0].Events) != 1 {
+		t.Fatalf("unexpected spans: %v", spans)
+	}
+	for _, kv := range spans[0].Events[0].Attributes {
+		if kv.Key == "exception.message" && kv.Value.AsString() != "***" {
+			t.Errorf("message: got %q", kv.Value.AsString())
+		}
+	}
+
+	if got := stackTrace([]byte("not a stack secret-2"), redactor); got != "not a stack ***" {
+		t.Errorf("raw stack: got %q", got)
+	}
+}
@@ -0,0 +1,300 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html/template"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// DefaultPanicRegistrySize is the default number of recent panics kept.
+const DefaultPanicRegistrySize = 50
+
+// DefaultPanicRegistryMaxSignatures is the default max number of signatures
+// kept.
+const DefaultPanicRegistryMaxSignatures = 1000
+
+// PanicSignature is the panics count of a stack signature.
+type PanicSignature struct {
+	// Signature is the hash of the panicking code path.
+	Signature string `json:"signature"`
+	// Frames is the stack frames after the panic call.
+	Frames []StackFrame `json:"frames"`
+	Count  uint64       `json:"count"`
+	First  time.Time    `json:"first"`
+	Last   time.Time    `json:"last"`
+	// LastValue is the last redacted panic value.
+	LastValue string `json:"last_value"`
+}
+
+// Top returns the frame that panicked, if any.
+func (s *PanicSignature) Top() (frame StackFrame) {
+	if len(s.Frames) > 0 {
+		frame = s.Frames[0]
+	}
+	return
+}
+
+// RecordedPanic is a recovered panic with the request metadata.
+type RecordedPanic struct {
+	Time      time.Time `json:"time"`
+	Signature string    `json:"signature"`
+	Value     string    `json:"value"`
+	Method    string    `json:"method"`
+	URI       string    `json:"uri"`
+	Route     string    `json:"route,omitempty"`
+	RemoteIP  string    `json:"remote_ip"`
+	RequestID string    `json:"request_id,omitempty"`
+	TraceID   string    `json:"trace_id,omitempty"`
+	// Stack is the redacted raw stack, unset if parsed into the signature
+	// frames.
+	Stack string `json:"stack,omitempty"`
+}
+
+// PanicRegistry counts the panics recovered by Recoverer by stack signature
+// and keeps the last panics with the request metadata. Use Handler as
+// middleware before Recoverer. It is also the debug http.Handler that lists
+// the signatures and recent panics, as JSON if requested by the Accept header
+// or the "json" query param, otherwise as HTML.
+type PanicRegistry struct {
+	// Redactor masks the sensitive data of the URI and panic value. Default is
+	// DefaultRedactor.
+	Redactor *Redactor
+	// MaxSignatures is the max number of signatures kept, the least recently
+	// seen is evicted. Default is DefaultPanicRegistryMaxSignatures.
+	MaxSignatures int
+
+	mu         sync.Mutex
+	size       int
+	total      uint64
+	signatures map[string]*PanicSignature
+	recent     []RecordedPanic
+	next       int
+}
+
+// NewPanicRegistry creates a new PanicRegistry keeping the last size panics.
+// If size is lower than 1, DefaultPanicRegistrySize is used.
+func NewPanicRegistry(size int) *PanicRegistry {
+	if size < 1 {
+		size = DefaultPanicRegistrySize
+	}
+	return &PanicRegistry{size: size, signatures: map[string]*PanicSignature{}}
+}
+
+// Handler is a middleware that registers the panics recovered by an inner
+// Recoverer.
+func (reg *PanicRegistry) Handler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, WithPanicObserver(r, reg))
+	})
+}
+
+// ObservePanic registers the panic.
+func (reg *PanicRegistry) ObservePanic(r *http.Request, v interface{}, stackb []byte) {
+	redactor := redactorOf(reg.Redactor)
+	p := RecordedPanic{
+		Time:      time.Now(),
+		Value:     redactor.String(fmt.Sprint(v)),
+		Method:    r.Method,
+		URI:       redactor.URI(r.RequestURI),
+		Route:     RoutePattern(r),
+		RemoteIP:  GetRealIP(r),
+		RequestID: middleware.GetReqID(r.Context()),
+		TraceID:   GetTraceID(r.Context()),
+	}
+	frames := panicFrames(stackb)
+	if frames == nil {
+		p.Stack = redactor.String(string(stackb))
+	}
+	p.Signature = panicSignature(frames, stackb)
+
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	if reg.signatures == nil {
+		reg.signatures = map[string]*PanicSignature{}
+	}
+	if reg.size < 1 {
+		reg.size = DefaultPanicRegistrySize
+	}
+	reg.total++
+	s := reg.signatures[p.Signature]
+	if s == nil {
+		reg.evictSignature()
+		s = &PanicSignature{Signature: p.Signature, Frames: frames, First: p.Time}
+		reg.signatures[p.Signature] = s
+	}
+	s.Count++
+	s.Last, s.LastValue = p.Time, p.Value
+
+	if len(reg.recent) < reg.size {
+		reg.recent = append(reg.recent, p)
+	} else {
+		reg.recent[reg.next] = p
+	}
+	reg.next = (reg.next + 1) % reg.size
+}
+
+// panicFrames returns the frames of the panicking goroutine after the panic
+// call, or nil if the stack is not parseable.
+func panicFrames(stackb []byte) []StackFrame {
+	buckets, err := ParseStack(stackb)
+	if err != nil || len(buckets) == 0 {
+		return nil
+	}
+	frames := StackFrames(buckets[:1])
+	for i, f := range frames {
+		if f.Func == "panic" || f.Func == "runtime.gopanic" {
+			frames = frames[i+1:]
+			break
+		}
+	}
+	// skip the runtime frames raising the panic, like runtime.panicmem
+	for len(frames) > 1 && strings.HasPrefix(frames[0].Func, "runtime.") {
+		frames = frames[1:]
+	}
+	return frames
+}
+
+// evictSignature removes the least recently seen signature if the max
+// number of signatures is reached.
+func (reg *PanicRegistry) evictSignature() {
+	max := reg.MaxSignatures
+	if max < 1 {
+		max = DefaultPanicRegistryMaxSignatures
+	}
+	if len(reg.signatures) < max {
+		return
+	}
+	var oldest *PanicSignature
+	for _, s := range reg.signatures {
+		if oldest == nil || s.Last.Before(oldest.Last) {
+			oldest = s
+		}
+	}
+	delete(reg.signatures, oldest.Signature)
+}
+
+var (
+	stackGoroutineRegexp = regexp.MustCompile(`(?m)^goroutine \d+ .*$|in goroutine \d+`)
+	stackHexRegexp       = regexp.MustCompile(`0x[0-9a-fA-F]+`)
+)
+
+// panicSignature returns the hash of the frames or, if the stack is not
+// parseable, of the raw stack without the goroutine IDs and addresses.
+func panicSignature(frames []StackFrame, stackb []byte) string {
+	h := fnv.New64a()
+	if frames == nil {
+		stackb = stackGoroutineRegexp.ReplaceAll(stackb, nil)
+		h.Write(stackHexRegexp.ReplaceAll(stackb, []byte("0x")))
+	}
+	for _, f := range frames {
+		fmt.Fprintf(h, "%s %s:%d\n", f.Func, f.File, f.Line)
+	}
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// Total returns the number of registered panics.
+func (reg *PanicRegistry) Total() uint64 {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return reg.total
+}
+
+// Signatures returns the panic signatures, most frequent first.
+func (reg *PanicRegistry) Signatures() []PanicSignature {
+	reg.mu.Lock()
+	signatures := make([]PanicSignature, 0, len(reg.signatures))
+	for _, s := range reg.signatures {
+		signatures = append(signatures, *s)
+	}
+	reg.mu.Unlock()
+	sort.Slice(signatures, func(i, j int) bool {
+		if signatures[i].Count != signatures[j].Count {
+			return signatures[i].Count > signatures[j].Count
+		}
+		return signatures[i].Last.After(signatures[j].Last)
+	})
+	return signatures
+}
+
+// Recent returns the recent panics, newest first.
+func (reg *PanicRegistry) Recent() []RecordedPanic {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	recent := make([]RecordedPanic, 0, len(reg.recent))
+	for i := 1; i <= len(reg.recent); i++ {
+		recent = append(recent, reg.recent[(reg.next-i+len(reg.recent))%len(reg.recent)])
+	}
+	return recent
+}
+
+func (reg *PanicRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	data := struct {
+		Total      uint64           `json:"total"`
+		Signatures []PanicSignature `json:"signatures"`
+		Recent     []RecordedPanic  `json:"recent"`
+	}{reg.Total(), reg.Signatures(), reg.Recent()}
+	if _, ok := r.URL.Query()["json"]; ok || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(data)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	panicRegistryTemplate.Execute(w, data)
+}
+
+var panicRegistryTemplate = template.Must(template.New("panics").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Panics</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; width: 100%; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #eee; }
+pre { margin: 0; font-size: 12px; }
+code { font-size: 12px; }
+</style>
+</head>
+<body>
+<h1>{{.Total}} panics</h1>
+<h2>Signatures</h2>
+<table>
+<tr><th>Count</th><th>Signature</th><th>Last value</th><th>First</th><th>Last</th><th>Stack</th></tr>
+{{range .Signatures}}<tr>
+<td>{{.Count}}</td>
+<td><code>{{.Signature}}</code></td>
+<td>{{.LastValue}}</td>
+<td>{{.First.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.Last.Format "2006-01-02 15:04:05"}}</td>
+<td><details><summary>{{with .Top}}{{.Func}} {{.File}}:{{.Line}}{{end}}</summary><pre>{{range .Frames}}{{.Func}}
+	{{.File}}:{{.Line}}
+{{end}}</pre></details></td>
+</tr>
+{{end}}</table>
+<h2>Recent</h2>
+<table>
+<tr><th>Time</th><th>Signature</th><th>Value</th><th>Request</th><th>Route</th><th>Remote IP</th><th>Request ID</th><th>Trace ID</th></tr>
+{{range .Recent}}<tr>
+<td>{{.Time.Format "2006-01-02 15:04:05"}}</td>
+<td><code>{{.Signature}}</code>{{if .Stack}}<details><summary>stack</summary><pre>{{.Stack}}</pre></details>{{end}}</td>
+<td>{{.Value}}</td>
+<td>{{.Method}} {{.URI}}</td>
+<td>{{.Route}}</td>
+<td>{{.RemoteIP}}</td>
+<td>{{.RequestID}}</td>
+<td>{{.TraceID}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
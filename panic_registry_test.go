@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPanicRegistry(t *testing.T) {
+	reg := NewPanicRegistry(2)
+	h := reg.Handler(Recoverer(quietPanicFormatter())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/a" {
+			panic("a")
+		}
+		panic("b")
+	})))
+	for _, target := range []string{"/a", "/b", "/a", "/a?token=secret"} {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", target, nil))
+	}
+
+	if total := reg.Total(); total != 4 {
+		t.Errorf("total: got %d", total)
+	}
+	signatures := reg.Signatures()
+	if len(signatures) != 2 || signatures[0].Count != 3 || signatures[0].LastValue != "a" || signatures[1].Count != 1 {
+		t.Fatalf("unexpected signatures: %+v", signatures)
+	}
+	if top := signatures[0].Top(); !strings.Contains(top.Func, "TestPanicRegistry") {
+		t.Errorf("top frame: got %+v", top)
+	}
+	recent := reg.Recent()
+	if len(recent) != 2 || recent[0].URI != "/a?token=***" || recent[1].URI != "/a" {
+		t.Errorf("unexpected recent: %+v", recent)
+	}
+
+	w := httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/?json", nil))
+	var data struct {
+		Total  uint64
+		Recent []RecordedPanic
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &data); err != nil || data.Total != 4 || len(data.Recent) != 2 {
+		t.Errorf("unexpected json: %v %s", err, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	reg.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if body := w.Body.String(); !strings.Contains(body, "<h1>4 panics</h1>") || !strings.Contains(body, signatures[0].Signature) {
+		t.Errorf("unexpected html: %s", body)
+	}
+}
+
+func TestPanicRegistry_RawStack(t *testing.T) {
+	reg := NewPanicRegistry(10)
+	reg.MaxSignatures = 2
+	r := httptest.NewRequest("GET", "/", nil)
+	reg.ObservePanic(r, "a", []byte("goroutine 7 [running]:\nnot a frame 0xc000012345 Bearer abc.def\n"))
+	reg.ObservePanic(r, "a", []byte("goroutine 9 [running]:\nnot a frame 0xc000099999 Bearer abc.def\n"))
+
+	signatures := reg.Signatures()
+	if len(signatures) != 1 || signatures[0].Count != 2 {
+		t.Fatalf("the goroutine ID and addresses split the signature: %+v", signatures)
+	}
+	if stack := reg.Recent()[0].Stack; strings.Contains(stack, "abc.def") || !strings.HasSuffix(stack, " ***\n") {
+		t.Errorf("stack not redacted: %q", stack)
+	}
+
+	reg.ObservePanic(r, "b", []byte("not a frame b\n"))
+	reg.ObservePanic(r, "c", []byte("not a frame c\n"))
+	signatures = reg.Signatures()
+	if len(signatures) != 2 || signatures[0].LastValue == "a" || signatures[1].LastValue == "a" {
+		t.Errorf("the least recent signature was not evicted: %+v", signatures)
+	}
+}
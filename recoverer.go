@@ -5,30 +5,105 @@ package middleware
 
 import (
 	"fmt"
+	"net"
 	"net/http"
 	"runtime/debug"
+	"strings"
 
 	"github.com/moisespsena-go/tracederror"
 
 	error_utils "github.com/unapu-go/error-utils"
 )
 
+// RecovererMode decides which clients receive the panic value and stack.
+type RecovererMode int
+
+const (
+	// RecovererModeAuto is RecovererModeDev in dev builds (the "dev" build
+	// tag), otherwise RecovererModeProduction.
+	RecovererModeAuto RecovererMode = iota
+	// RecovererModeDev sends the panic value and stack to all clients.
+	RecovererModeDev
+	// RecovererModeProduction sends the panic value and stack only to the
+	// RecovererOpts.StackAllowedIPs clients, and a generic error with the
+	// request ID to everyone else.
+	RecovererModeProduction
+)
+
+// RecovererOpts is the NewRecoverer options.
+type RecovererOpts struct {
+	// Formatter creates the panic log entry. Default is the in-context
+	// PanicEntry or the DefaultRequestLogFormatter.
+	Formatter PanicFormatter
+	Mode      RecovererMode
+	// StackAllowedIPs is the client IPs or CIDRs, like "10.0.0.0/8", that
+	// receive the panic value and stack in production mode. The client IP is
+	// read from the request RemoteAddr, use chi middleware.RealIP before the
+	// Recoverer if behind a trusted proxy.
+	StackAllowedIPs []string
+	// HTMLRenderer, JSONRenderer and TextRenderer write the error response
+	// negotiated by the Accept header. Defaults are RenderPanicHTML,
+	// RenderPanicProblemJSON and RenderPanicText.
+	HTMLRenderer, JSONRenderer, TextRenderer PanicRenderer
+	// Redactor masks the sensitive data of the error response and of the dev
+	// build panic log. Default is the Formatter Redactor, if any, otherwise
+	// DefaultRedactor.
+	Redactor *Redactor
+}
+
 // Recoverer is a middleware that recovers from panics, logs the panic (and a
 // backtrace), and returns a HTTP 500 (Internal Server Error) status if
-// possible. Recoverer prints a request BID if one is provided.
+// possible. If the response was already committed, the panic is only logged
+// and the response aborted with http.ErrAbortHandler. The http.ErrAbortHandler
+// panics are not logged and panic again, as net/http does. Recoverer prints a
+// request BID if one is provided. The response is HTML, problem JSON or text,
+// by the Accept header, and the panic value and stack are sent to the client
+// only in dev builds, see NewRecoverer.
 func Recoverer(f ...PanicFormatter) func(next http.Handler) http.Handler {
+	opts := &RecovererOpts{}
+	if len(f) > 0 {
+		opts.Formatter = f[0]
+	}
+	return NewRecoverer(opts)
+}
+
+// NewRecoverer returns a Recoverer middleware using the options. It panics if
+// the StackAllowedIPs are invalid.
+func NewRecoverer(opts *RecovererOpts) func(next http.Handler) http.Handler {
+	if opts == nil {
+		opts = &RecovererOpts{}
+	}
 	var gpe func(r *http.Request) PanicEntry
-	for _, f := range f {
-		gpe = f.NewPanicEntry
-		break
+	if opts.Formatter != nil {
+		gpe = opts.Formatter.NewPanicEntry
+	}
+	showStack := recovererShowStack(opts)
+	redactor := opts.Redactor
+	if redactor == nil {
+		redactor = formatterRedactor(opts.Formatter)
+	}
+	renderers := [...]PanicRenderer{
+		panicTypeText: opts.TextRenderer,
+		panicTypeHTML: opts.HTMLRenderer,
+		panicTypeJSON: opts.JSONRenderer,
+	}
+	for i, def := range [...]PanicRenderer{RenderPanicText, RenderPanicHTML, RenderPanicProblemJSON} {
+		if renderers[i] == nil {
+			renderers[i] = def
+		}
 	}
 
 	return func(next http.Handler) http.Handler {
 		fn := func(w http.ResponseWriter, r *http.Request) {
+			ww, rec := newResponseRecorder(w)
 			defer func() {
 				if rvr := recover(); rvr != nil {
+					if rvr == http.ErrAbortHandler {
+						panic(rvr)
+					}
+
 					var (
-						errb []byte
+						errb       []byte
 						panicEntry PanicEntry
 					)
 
@@ -53,23 +128,84 @@ func Recoverer(f ...PanicFormatter) func(next http.Handler) http.Handler {
 						}
 					}
 
-					var msg = http.StatusText(http.StatusInternalServerError)
-					if len(errb) > 0 {
-						msg = fmt.Sprintf("<pre>%s\n%s\n\n%s</pre>", msg, fmt.Sprint(rvr), string(errb))
+					ObservePanic(r, rvr, errb)
+
+					// a committed response can not be replaced by the error
+					// response, so it is aborted after the panic is logged
+					committed := rec.committed()
+					if !committed {
+						renderers[negotiatePanicType(r.Header.Get("Accept"))](ww, newPanicResponse(r, redactor, rvr, errb, len(errb) > 0 && showStack(r)))
 					}
-					http.Error(w, msg, http.StatusInternalServerError)
 
 					if len(errb) > 0 {
 						go func() {
-							recovererPanic(rvr, errb)
+							recovererPanic(redactor.String(fmt.Sprint(rvr)), []byte(redactor.String(string(errb))))
 							panicEntry.Write(rvr, errb)
 						}()
 					}
+
+					if committed && !rec.hijacked {
+						panic(http.ErrAbortHandler)
+					}
 				}
 			}()
 
-			next.ServeHTTP(w, r)
+			next.ServeHTTP(ww, r)
 		}
 		return http.HandlerFunc(fn)
 	}
 }
+
+// formatterRedactor returns the Redactor of the formatters of this package,
+// or DefaultRedactor.
+func formatterRedactor(f PanicFormatter) *Redactor {
+	if f, ok := f.(interface{ redactor() *Redactor }); ok {
+		return f.redactor()
+	}
+	return DefaultRedactor
+}
+
+// recovererShowStack returns the func that reports whether the client
+// receives the panic value and stack.
+func recovererShowStack(opts *RecovererOpts) func(r *http.Request) bool {
+	mode := opts.Mode
+	if mode == RecovererModeAuto {
+		mode = RecovererModeProduction
+		if recovererDevMode {
+			mode = RecovererModeDev
+		}
+	}
+	if mode == RecovererModeDev {
+		return func(*http.Request) bool { return true }
+	}
+	var networks []*net.IPNet
+	for _, v := range opts.StackAllowedIPs {
+		if !strings.Contains(v, "/") {
+			if ip := net.ParseIP(v); ip != nil && ip.To4() != nil {
+				v += "/32"
+			} else {
+				v += "/128"
+			}
+		}
+		_, network, err := net.ParseCIDR(v)
+		if err != nil {
+			panic(fmt.Errorf("middleware: bad recoverer allowed IP %q: %v", v, err))
+		}
+		networks = append(networks, network)
+	}
+	return func(r *http.Request) bool {
+		if len(networks) == 0 {
+			return false
+		}
+		ip := remoteIP(r)
+		if ip == nil {
+			return false
+		}
+		for _, network := range networks {
+			if network.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+}
@@ -2,4 +2,8 @@
 
 package middleware
 
+// recovererDevMode is whether the Recoverer sends the stack to all clients
+// by default.
+const recovererDevMode = false
+
 func recovererPanic(interface{}, []byte) {}
@@ -7,6 +7,10 @@ import (
 	"github.com/moisespsena-go/path-helpers"
 )
 
+// recovererDevMode is whether the Recoverer sends the stack to all clients
+// by default.
+const recovererDevMode = true
+
 var reclog = logging.GetOrCreateLogger(path_helpers.GetCalledDir()+".recoverer_panic")
 
 func recovererPanic(r interface{}, stack []byte) {
@@ -0,0 +1,217 @@
+package middleware
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// PanicResponse is the data of the Recoverer error response.
+type PanicResponse struct {
+	Request *http.Request
+	// URI is the redacted request URI.
+	URI    string
+	Status int
+	// ShowStack is whether Value, Stack and Frames are sent to the client.
+	// See RecovererOpts.Mode.
+	ShowStack bool
+	// Value is the redacted panic value.
+	Value string
+	// Stack is the redacted raw stack and Frames the parsed stack, nil if the
+	// stack is not parseable.
+	Stack  string
+	Frames []StackFrame
+	// RequestID is the chi request ID, if any.
+	RequestID string
+	// TraceID is the trace ID, if any. See TraceParent.
+	TraceID string
+}
+
+// PanicRenderer writes the Recoverer error response.
+type PanicRenderer func(w http.ResponseWriter, p *PanicResponse)
+
+// Recoverer response types negotiated by the Accept header.
+const (
+	panicTypeText = iota
+	panicTypeHTML
+	panicTypeJSON
+)
+
+// negotiatePanicType returns the best response type for the Accept header.
+// Explicit media types are preferred over the wildcards with the same q.
+func negotiatePanicType(accept string) int {
+	var (
+		best         = panicTypeText
+		bestQ        = -1.0
+		bestExplicit bool
+	)
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		q := 1.0
+		for _, param := range params[1:] {
+			if kv := strings.SplitN(strings.TrimSpace(param), "=", 2); len(kv) == 2 && kv[0] == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		if q <= 0 {
+			continue
+		}
+		typ, explicit := panicTypeText, true
+		switch {
+		case mediaType == "text/html", mediaType == "application/xhtml+xml":
+			typ = panicTypeHTML
+		case mediaType == "application/json", mediaType == "application/problem+json",
+			strings.HasPrefix(mediaType, "application/") && strings.HasSuffix(mediaType, "+json"):
+			typ = panicTypeJSON
+		case mediaType == "text/plain":
+		case mediaType == "*/*", mediaType == "text/*":
+			explicit = false
+		default:
+			continue
+		}
+		if q > bestQ || (q == bestQ && explicit && !bestExplicit) {
+			best, bestQ, bestExplicit = typ, q, explicit
+		}
+	}
+	return best
+}
+
+// newPanicResponse creates the panic response data.
+func newPanicResponse(r *http.Request, redactor *Redactor, v interface{}, stackb []byte, showStack bool) *PanicResponse {
+	p := &PanicResponse{
+		Request:   r,
+		URI:       redactor.URI(r.RequestURI),
+		Status:    http.StatusInternalServerError,
+		ShowStack: showStack,
+		RequestID: middleware.GetReqID(r.Context()),
+		TraceID:   GetTraceID(r.Context()),
+	}
+	if showStack {
+		p.Value = redactor.String(fmt.Sprint(v))
+		p.Stack = redactor.String(string(stackb))
+		if buckets, err := ParseStack(stackb); err == nil {
+			p.Frames = StackFrames(buckets[:1])
+			for i := range p.Frames {
+				p.Frames[i].Func = redactor.String(p.Frames[i].Func)
+			}
+		}
+	}
+	return p
+}
+
+// writePanicHeader writes the response header with the content type.
+func writePanicHeader(w http.ResponseWriter, p *PanicResponse, contentType string) {
+	h := w.Header()
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Set("Content-Type", contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+}
+
+// RenderPanicText writes the panic response as text/plain.
+func RenderPanicText(w http.ResponseWriter, p *PanicResponse) {
+	writePanicHeader(w, p, "text/plain; charset=utf-8")
+	var b strings.Builder
+	b.WriteString(http.StatusText(p.Status) + "\n")
+	if p.RequestID != "" {
+		b.WriteString("Request ID: " + p.RequestID + "\n")
+	}
+	if p.ShowStack {
+		b.WriteString("\n" + p.Value + "\n\n" + p.Stack)
+	}
+	w.Write([]byte(b.String()))
+}
+
+// ProblemDetails is the RFC 7807 problem details of the panic response.
+type ProblemDetails struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	TraceID   string       `json:"trace_id,omitempty"`
+	Stack     []StackFrame `json:"stack,omitempty"`
+	RawStack  string       `json:"raw_stack,omitempty"`
+}
+
+// RenderPanicProblemJSON writes the panic response as
+// application/problem+json (RFC 7807).
+func RenderPanicProblemJSON(w http.ResponseWriter, p *PanicResponse) {
+	writePanicHeader(w, p, "application/problem+json")
+	problem := ProblemDetails{
+		Type:      "about:blank",
+		Title:     http.StatusText(p.Status),
+		Status:    p.Status,
+		RequestID: p.RequestID,
+		TraceID:   p.TraceID,
+	}
+	if p.ShowStack {
+		problem.Detail = p.Value
+		problem.Instance = p.URI
+		if problem.Stack = p.Frames; p.Frames == nil {
+			problem.RawStack = p.Stack
+		}
+	}
+	json.NewEncoder(w).Encode(problem)
+}
+
+// RenderPanicHTML writes the panic response as a HTML page, with the
+// colorized and collapsible stack if shown.
+func RenderPanicHTML(w http.ResponseWriter, p *PanicResponse) {
+	writePanicHeader(w, p, "text/html; charset=utf-8")
+	panicHTMLTemplate.Execute(w, struct {
+		*PanicResponse
+		Title string
+	}{p, http.StatusText(p.Status)})
+}
+
+var panicHTMLTemplate = template.Must(template.New("panic").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Status}} {{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 0; background: #f6f6f6; color: #222; }
+main { max-width: 64em; margin: 3em auto; padding: 2em; background: #fff; border-top: 4px solid #c0392b; box-shadow: 0 1px 3px rgba(0,0,0,.1); }
+h1 { margin-top: 0; font-weight: 400; }
+.ids { color: #666; font-size: .9em; }
+.value { font-family: monospace; font-size: 1.1em; color: #c0392b; white-space: pre-wrap; word-break: break-all; }
+details { margin: .2em 0; font-family: monospace; font-size: .9em; }
+summary { cursor: pointer; }
+.func { color: #2c3e50; font-weight: bold; }
+.pkg { color: #8e44ad; }
+.file { color: #27ae60; }
+.line { color: #d35400; }
+pre { background: #272822; color: #f8f8f2; padding: 1em; overflow: auto; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Status}} {{.Title}}</h1>
+{{if .RequestID}}<p class="ids">Request ID: <code>{{.RequestID}}</code></p>{{end}}
+{{if .TraceID}}<p class="ids">Trace ID: <code>{{.TraceID}}</code></p>{{end}}
+{{if .ShowStack}}
+<p class="value">{{.Value}}</p>
+{{if .Frames}}<details open><summary>Stack trace ({{len .Frames}} frames)</summary>
+{{range .Frames}}<div><span class="func">{{.Func}}</span> <span class="pkg">{{.Pkg}}</span><br>&nbsp;&nbsp;<span class="file">{{.File}}</span>:<span class="line">{{.Line}}</span></div>
+{{end}}</details>
+<details><summary>Raw stack</summary><pre>{{.Stack}}</pre></details>
+{{else}}<pre>{{.Stack}}</pre>{{end}}
+{{else}}
+<p>Sorry, something went wrong.{{if .RequestID}} Please include the request ID above when reporting this error.{{end}}</p>
+{{end}}
+</main>
+</body>
+</html>
+`))
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/middleware"
+)
+
+// quietPanicFormatter discards the panic logs.
+func quietPanicFormatter() *DefaultLogAndPanicFormatter {
+	return NewDefaultRequestLogFormatter(ioutil.Discard, ioutil.Discard, "")
+}
+
+func TestNewRecoverer_Mode(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("secret value")
+	})
+	tests := []struct {
+		name   string
+		opts   *RecovererOpts
+		remote string
+		stack  bool
+	}{
+		{"dev", &RecovererOpts{Mode: RecovererModeDev}, "192.0.2.1:1", true},
+		{"production", &RecovererOpts{Mode: RecovererModeProduction}, "192.0.2.1:1", false},
+		{"allowed ip", &RecovererOpts{Mode: RecovererModeProduction, StackAllowedIPs: []string{"10.0.0.0/8", "192.0.2.1"}}, "192.0.2.1:1", true},
+		{"not allowed ip", &RecovererOpts{Mode: RecovererModeProduction, StackAllowedIPs: []string{"10.0.0.0/8"}}, "192.0.2.1:1", false},
+		{"auto", &RecovererOpts{}, "192.0.2.1:1", recovererDevMode},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.opts.Formatter = quietPanicFormatter()
+			h := middleware.RequestID(NewRecoverer(tt.opts)(panicking))
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tt.remote
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("status: got %d", w.Code)
+			}
+			body := w.Body.String()
+			if got := strings.Contains(body, "secret value"); got != tt.stack {
+				t.Errorf("stack sent: got %v, want %v: %s", got, tt.stack, body)
+			}
+			if !tt.stack && !strings.Contains(body, "Request ID: ") {
+				t.Errorf("request ID not sent: %s", body)
+			}
+		})
+	}
+}
+
+func TestNegotiatePanicType(t *testing.T) {
+	tests := []struct {
+		accept string
+		want   int
+	}{
+		{"", panicTypeText},
+		{"*/*", panicTypeText},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", panicTypeHTML},
+		{"application/json", panicTypeJSON},
+		{"application/vnd.api+json", panicTypeJSON},
+		{"application/problem+json, text/html;q=0.5", panicTypeJSON},
+		{"text/html;q=0.2, text/plain", panicTypeText},
+		{"*/*, application/json", panicTypeJSON},
+		{"application/json;q=0, text/html;q=0.1", panicTypeHTML},
+		{"image/png", panicTypeText},
+	}
+	for _, tt := range tests {
+		if got := negotiatePanicType(tt.accept); got != tt.want {
+			t.Errorf("%q: got %d, want %d", tt.accept, got, tt.want)
+		}
+	}
+}
+
+func TestNewRecoverer_Render(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", "10")
+		panic("boom")
+	})
+	tests := []struct {
+		accept, contentType, want string
+	}{
+		{"text/html", "text/html; charset=utf-8", `<p class="value">boom</p>`},
+		{"application/json", "application/problem+json", `"detail":"boom"`},
+		{"", "text/plain; charset=utf-8", "Internal Server Error\n"},
+	}
+	for _, tt := range tests {
+		h := NewRecoverer(&RecovererOpts{Formatter: quietPanicFormatter(), Mode: RecovererModeDev})(panicking)
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if got := w.Header().Get("Content-Type"); got != tt.contentType {
+			t.Errorf("%q: content type: got %q", tt.accept, got)
+		}
+		if w.Header().Get("Content-Length") != "" {
+			t.Errorf("%q: content length not removed", tt.accept)
+		}
+		if body := w.Body.String(); !strings.Contains(body, tt.want) || strings.Contains(body, "<pre>Internal") {
+			t.Errorf("%q: unexpected body: %s", tt.accept, body)
+		}
+	}
+
+	h := NewRecoverer(&RecovererOpts{Formatter: quietPanicFormatter(), JSONRenderer: func(w http.ResponseWriter, p *PanicResponse) {
+		w.WriteHeader(http.StatusTeapot)
+	}})(panicking)
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusTeapot {
+		t.Errorf("renderer not overridden: %d", w.Code)
+	}
+}
+
+func TestNewRecoverer_Committed(t *testing.T) {
+	logged := make(chan bool, 1)
+	reg := PanicObserverFunc(func(r *http.Request, v interface{}, stack []byte) { logged <- true })
+	h := NewRecoverer(&RecovererOpts{Formatter: quietPanicFormatter(), Mode: RecovererModeDev})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("partial"))
+		w.(http.Flusher).Flush()
+		panic("boom")
+	}))
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, WithPanicObserver(r, reg))
+	}))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := ioutil.ReadAll(res.Body)
+	if res.StatusCode != http.StatusOK || string(body) != "partial" || err == nil {
+		t.Errorf("response not aborted: %d %q %v", res.StatusCode, body, err)
+	}
+	select {
+	case <-logged:
+	default:
+		t.Error("panic not observed")
+	}
+}
+
+func TestNewRecoverer_ErrAbortHandler(t *testing.T) {
+	var logged bool
+	h := NewRecoverer(&RecovererOpts{Formatter: quietPanicFormatter()})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	r := WithPanicObserver(httptest.NewRequest("GET", "/", nil), PanicObserverFunc(func(r *http.Request, v interface{}, stack []byte) { logged = true }))
+	w := httptest.NewRecorder()
+	defer func() {
+		if rvr := recover(); rvr != http.ErrAbortHandler {
+			t.Errorf("got panic %v, want http.ErrAbortHandler", rvr)
+		}
+		if logged || w.Body.Len() > 0 {
+			t.Errorf("aborted handler logged or written: %q", w.Body.String())
+		}
+	}()
+	h.ServeHTTP(w, r)
+}
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// DefaultRedactMask is the default value of the masked data.
+const DefaultRedactMask = "***"
+
+var (
+	// DefaultRedactQueryParams is the default query params masked by
+	// DefaultRedactor.
+	DefaultRedactQueryParams = []string{
+		"access_token", "refresh_token", "id_token", "token", "auth", "code",
+		"api_key", "apikey", "key", "secret", "client_secret",
+		"password", "passwd", "pwd", "signature", "sig",
+	}
+	// DefaultRedactHeaders is the default headers masked by DefaultRedactor.
+	DefaultRedactHeaders = []string{
+		"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie",
+		"X-Api-Key", "X-Auth-Token", "X-Csrf-Token",
+	}
+	// DefaultRedactCookies is the default cookies masked by DefaultRedactor.
+	DefaultRedactCookies = []string{
+		"session", "sessionid", "sid", "token", "jwt", "csrftoken",
+	}
+	// DefaultRedactPatterns is the default patterns masked by DefaultRedactor.
+	DefaultRedactPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`(?i)\bbearer\s+[\w.~+/-]+=*`),
+		regexp.MustCompile(`\beyJ[\w-]+\.[\w-]+\.[\w-]+`),
+	}
+
+	// DefaultRedactor is the Redactor used by formatters without Redactor.
+	DefaultRedactor = &Redactor{
+		QueryParams: DefaultRedactQueryParams,
+		Headers:     DefaultRedactHeaders,
+		Cookies:     DefaultRedactCookies,
+		Patterns:    DefaultRedactPatterns,
+	}
+
+	// NoRedactor disables the redaction.
+	NoRedactor = &Redactor{}
+)
+
+// Redactor masks sensitive data before it is logged. Names are case
+// insensitive. The fields must not be changed after the first use.
+type Redactor struct {
+	QueryParams []string
+	Headers     []string
+	Cookies     []string
+	Patterns    []*regexp.Regexp
+	// Mask replaces the sensitive values. Default is DefaultRedactMask.
+	Mask string
+
+	once                   sync.Once
+	params, headers, cooks map[string]bool
+}
+
+// redactorOf returns r or DefaultRedactor if r is nil.
+func redactorOf(r *Redactor) *Redactor {
+	if r == nil {
+		return DefaultRedactor
+	}
+	return r
+}
+
+func (this *Redactor) init() {
+	this.once.Do(func() {
+		this.params = lowerSet(this.QueryParams)
+		this.headers = lowerSet(this.Headers)
+		this.cooks = lowerSet(this.Cookies)
+		if this.Mask == "" {
+			this.Mask = DefaultRedactMask
+		}
+	})
+}
+
+func lowerSet(values []string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, v := range values {
+		m[strings.ToLower(v)] = true
+	}
+	return m
+}
+
+// String masks the Patterns matches.
+func (this *Redactor) String(s string) string {
+	this.init()
+	for _, p := range this.Patterns {
+		s = p.ReplaceAllLiteralString(s, this.Mask)
+	}
+	return s
+}
+
+// URI masks the values of QueryParams and the Patterns matches.
+func (this *Redactor) URI(uri string) string {
+	this.init()
+	if i := strings.IndexByte(uri, '?'); i >= 0 && len(this.params) > 0 {
+		uri = uri[:i+1] + this.query(uri[i+1:])
+	}
+	return this.String(uri)
+}
+
+func (this *Redactor) query(query string) string {
+	pairs := strings.Split(query, "&")
+	for i, pair := range pairs {
+		rawKey := pair
+		if eq := strings.IndexByte(pair, '='); eq >= 0 {
+			rawKey = pair[:eq]
+		} else {
+			continue
+		}
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			key = rawKey
+		}
+		if this.params[strings.ToLower(key)] {
+			pairs[i] = rawKey + "=" + this.Mask
+		}
+	}
+	return strings.Join(pairs, "&")
+}
+
+// QueryParam returns the query param value or Mask if redacted.
+func (this *Redactor) QueryParam(name, value string) string {
+	this.init()
+	if value != "" && this.params[strings.ToLower(name)] {
+		return this.Mask
+	}
+	return this.String(value)
+}
+
+// Header returns the header value or Mask if redacted. The Cookie header
+// value has the Cookies masked.
+func (this *Redactor) Header(name, value string) string {
+	this.init()
+	if value == "" {
+		return value
+	}
+	if this.headers[strings.ToLower(name)] {
+		return this.Mask
+	}
+	if strings.EqualFold(name, "Referer") {
+		return this.URI(value)
+	}
+	if len(this.cooks) > 0 && http.CanonicalHeaderKey(name) == "Cookie" {
+		cookies := strings.Split(value, ";")
+		for i, c := range cookies {
+			if eq := strings.IndexByte(c, '='); eq >= 0 && this.cooks[strings.ToLower(strings.TrimSpace(c[:eq]))] {
+				cookies[i] = c[:eq+1] + this.Mask
+			}
+		}
+		value = strings.Join(cookies, ";")
+	}
+	return this.String(value)
+}
+
+// Cookie returns the cookie value or Mask if redacted.
+func (this *Redactor) Cookie(name, value string) string {
+	this.init()
+	if value != "" && this.cooks[strings.ToLower(name)] {
+		return this.Mask
+	}
+	return this.String(value)
+}
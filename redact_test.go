@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"bytes"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRedactor(t *testing.T) {
+	r := DefaultRedactor
+	tests := []struct {
+		name, got, want string
+	}{
+		{"uri", r.URI("/a?access_token=x&b=1&API_KEY=y&flag"), "/a?access_token=***&b=1&API_KEY=***&flag"},
+		{"uri no query", r.URI("/a/b"), "/a/b"},
+		{"param", r.QueryParam("password", "x"), "***"},
+		{"header", r.Header("authorization", "Basic x"), "***"},
+		{"header pattern", r.Header("X-Other", "Bearer abc.def"), "***"},
+		{"referer", r.Header("Referer", "http://h/?token=x"), "http://h/?token=***"},
+		{"cookie", r.Cookie("SessionID", "x"), "***"},
+		{"cookie kept", r.Cookie("theme", "dark"), "dark"},
+		{"string", r.String("panic: eyJa.eyJb.sig"), "panic: ***"},
+		{"disabled", NoRedactor.URI("/a?token=x"), "/a?token=x"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.got != tt.want {
+				t.Errorf("got %q, want %q", tt.got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactor_Panic(t *testing.T) {
+	custom := &Redactor{Patterns: []*regexp.Regexp{regexp.MustCompile(`secret-\d+`)}}
+
+	var out bytes.Buffer
+	entries := []PanicEntry{
+		(&DefaultLogAndPanicFormatter{Logger: log.New(&out, "", 0), NoColor: true, LogFormatterConfig: LogFormatterConfig{Redactor: custom}}).NewPanicEntry(httptest.NewRequest("GET", "/", nil)),
+		(&JSONLogFormatter{Logger: log.New(&out, "", 0), LogFormatterConfig: LogFormatterConfig{Redactor: custom}}).NewPanicEntry(httptest.NewRequest("GET", "/", nil)),
+		(&SlogLogFormatter{Logger: slog.New(slog.NewTextHandler(&out, nil)), LogFormatterConfig: LogFormatterConfig{Redactor: custom}}).NewPanicEntry(httptest.NewRequest("GET", "/", nil)),
+	}
+	for _, entry := range entries {
+		out.Reset()
+		entry.Write("v secret-1", []byte("not a stack secret-2"))
+		if got := out.String(); strings.Contains(got, "secret-") || !strings.Contains(got, "not a stack ***") {
+			t.Errorf("%T: not redacted: %s", entry, got)
+		}
+	}
+
+	f := quietPanicFormatter()
+	f.Redactor = custom
+	for _, opts := range []*RecovererOpts{{Formatter: f}, {Redactor: custom, Formatter: quietPanicFormatter()}} {
+		opts.Mode = RecovererModeDev
+		h := NewRecoverer(opts)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("secret-3")
+		}))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+		if body := w.Body.String(); strings.Contains(body, "secret-3") || !strings.Contains(body, "***") {
+			t.Errorf("response not redacted: %s", body)
+		}
+	}
+}
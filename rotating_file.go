@@ -0,0 +1,307 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RotatedFileTimeFormat is the time layout of the rotated file name suffix.
+const RotatedFileTimeFormat = "20060102-150405"
+
+// RotatingFileOpts configures RotatingFile.
+type RotatingFileOpts struct {
+	// MaxSize is the max file size in bytes before rotation. Zero disables.
+	MaxSize int64
+	// Interval is the rotation interval, aligned to UTC (24h rotates at
+	// midnight UTC). Zero disables.
+	Interval time.Duration
+	// MaxFiles is the max rotated files kept. Zero keeps all.
+	MaxFiles int
+	// Compress gzips the rotated files.
+	Compress bool
+	// Perm is the file permission. Default is 0644.
+	Perm os.FileMode
+}
+
+// RotatingFile is an io.WriteCloser that writes to a file rotated by size
+// and/or time. The rotated files are renamed to "<path>.<time>" and
+// optionally gzipped. Use it as out/err writer of the formatters:
+//
+//	access, panics, err := OpenRotatingLogFiles("access.log", "panic.log", &RotatingFileOpts{MaxSize: 100 << 20, MaxFiles: 10})
+//	formatter := NewDefaultRequestLogFormatter(access, panics, "")
+//	stop := ReopenOnSIGHUP(access, panics)
+type RotatingFile struct {
+	path string
+	opts RotatingFileOpts
+
+	mu     sync.Mutex
+	file   *os.File
+	closed bool
+	size   int64
+	rotate time.Time
+	wg     sync.WaitGroup
+	// cleanMu runs the compression and removal of the rotated files serially
+	cleanMu sync.Mutex
+}
+
+// OpenRotatingFile opens (or creates) the file in append mode.
+func OpenRotatingFile(path string, opts *RotatingFileOpts) (*RotatingFile, error) {
+	f := &RotatingFile{path: path}
+	if opts != nil {
+		f.opts = *opts
+	}
+	if f.opts.Perm == 0 {
+		f.opts.Perm = 0644
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// OpenRotatingLogFiles opens the access and panic log files. If panicPath
+// is empty or equals to accessPath, both are the same file.
+func OpenRotatingLogFiles(accessPath, panicPath string, opts *RotatingFileOpts) (access, panics *RotatingFile, err error) {
+	if access, err = OpenRotatingFile(accessPath, opts); err != nil {
+		return
+	}
+	if panicPath == "" || panicPath == accessPath {
+		return access, access, nil
+	}
+	if panics, err = OpenRotatingFile(panicPath, opts); err != nil {
+		access.Close()
+		return nil, nil, err
+	}
+	return
+}
+
+// Path returns the file path.
+func (f *RotatingFile) Path() string {
+	return f.path
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, f.opts.Perm)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file, f.size = file, info.Size()
+	if f.opts.Interval > 0 {
+		f.rotate = time.Now().Truncate(f.opts.Interval).Add(f.opts.Interval)
+	}
+	return nil
+}
+
+// Write writes to the file, rotating it if needed. If the rotation fails, p
+// is still written to the not rotated file when possible.
+func (f *RotatingFile) Write(p []byte) (n int, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+	if f.file == nil {
+		// a previous reopen failed
+		if err = f.open(); err != nil {
+			return
+		}
+	}
+	if f.needsRotate(len(p)) {
+		if err = f.doRotate(); err != nil && f.file == nil {
+			return
+		}
+	}
+	n, err = f.file.Write(p)
+	f.size += int64(n)
+	return
+}
+
+func (f *RotatingFile) needsRotate(n int) bool {
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(n) > f.opts.MaxSize {
+		return true
+	}
+	return !f.rotate.IsZero() && !time.Now().Before(f.rotate)
+}
+
+// Rotate rotates the file now.
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file == nil {
+		if err := f.open(); err != nil {
+			return err
+		}
+	}
+	return f.doRotate()
+}
+
+// doRotate renames the file and opens a new one. If the rotation fails, the
+// file is reopened.
+func (f *RotatingFile) doRotate() error {
+	err := f.file.Close()
+	f.file = nil
+	if err != nil {
+		f.open()
+		return err
+	}
+	name := f.path + "." + time.Now().Format(RotatedFileTimeFormat)
+	for i := 1; fileExists(name) || fileExists(name+".gz"); i++ {
+		name = f.path + "." + time.Now().Format(RotatedFileTimeFormat) + "." + strconv.Itoa(i)
+	}
+	if err := os.Rename(f.path, name); err != nil && !os.IsNotExist(err) {
+		f.open()
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+	f.wg.Add(1)
+	go func() {
+		defer f.wg.Done()
+		f.cleanMu.Lock()
+		defer f.cleanMu.Unlock()
+		if f.opts.Compress {
+			gzipFile(name)
+		}
+		f.removeOld()
+	}()
+	return nil
+}
+
+// Reopen closes and reopens the file, for use after external rotation.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return os.ErrClosed
+	}
+	if f.file != nil {
+		f.file.Close()
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the file and waits for the rotated files compression.
+func (f *RotatingFile) Close() (err error) {
+	f.mu.Lock()
+	f.closed = true
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+	f.wg.Wait()
+	return
+}
+
+// Rotated returns the rotated files, oldest first. A file being compressed is
+// returned once, without the ".gz" suffix.
+func (f *RotatingFile) Rotated() ([]string, error) {
+	names, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	type rotatedFile struct {
+		name  string
+		time  string
+		index int
+	}
+	var (
+		prefix = f.path + "."
+		files  []rotatedFile
+	)
+	exists := make(map[string]bool, len(names))
+	for _, name := range names {
+		exists[name] = true
+	}
+	for _, name := range names {
+		if strings.HasSuffix(name, ".gz") && exists[strings.TrimSuffix(name, ".gz")] {
+			continue
+		}
+		suffix := strings.TrimSuffix(name[len(prefix):], ".gz")
+		rf := rotatedFile{name: name, time: suffix}
+		if i := strings.IndexByte(suffix, '.'); i >= 0 {
+			if rf.index, err = strconv.Atoi(suffix[i+1:]); err != nil {
+				continue
+			}
+			rf.time = suffix[:i]
+		}
+		if _, err := time.Parse(RotatedFileTimeFormat, rf.time); err == nil {
+			files = append(files, rf)
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].time == files[j].time {
+			return files[i].index < files[j].index
+		}
+		return files[i].time < files[j].time
+	})
+	rotated := make([]string, len(files))
+	for i, rf := range files {
+		rotated[i] = rf.name
+	}
+	return rotated, nil
+}
+
+func (f *RotatingFile) removeOld() {
+	if f.opts.MaxFiles <= 0 {
+		return
+	}
+	rotated, err := f.Rotated()
+	if err != nil {
+		return
+	}
+	for len(rotated) > f.opts.MaxFiles {
+		os.Remove(rotated[0])
+		if !strings.HasSuffix(rotated[0], ".gz") {
+			os.Remove(rotated[0] + ".gz")
+		}
+		rotated = rotated[1:]
+	}
+}
+
+func fileExists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
+
+// gzipFile compresses the file to "<name>.gz" and removes it.
+func gzipFile(name string) (err error) {
+	src, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(name+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err = io.Copy(zw, src); err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(name + ".gz")
+		return
+	}
+	return os.Remove(name)
+}
@@ -0,0 +1,9 @@
+//go:build js || wasip1
+// +build js wasip1
+
+package middleware
+
+// ReopenOnSIGHUP does nothing, the platform has no SIGHUP.
+func ReopenOnSIGHUP(files ...*RotatingFile) (stop func()) {
+	return func() {}
+}
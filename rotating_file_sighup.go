@@ -0,0 +1,38 @@
+//go:build !js && !wasip1
+// +build !js,!wasip1
+
+package middleware
+
+import (
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// ReopenOnSIGHUP reopens the files when the process receives SIGHUP, as
+// expected by logrotate. Call stop to stop listening.
+func ReopenOnSIGHUP(files ...*RotatingFile) (stop func()) {
+	c := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	signal.Notify(c, syscall.SIGHUP)
+	go func() {
+		for {
+			select {
+			case <-c:
+				for _, f := range files {
+					f.Reopen()
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(c)
+			close(done)
+		})
+	}
+}
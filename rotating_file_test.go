@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readRotated(t *testing.T, name string) string {
+	t.Helper()
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.HasSuffix(name, ".gz") {
+		zr, err := gzip.NewReader(strings.NewReader(string(data)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if data, err = ioutil.ReadAll(zr); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return string(data)
+}
+
+func TestRotatingFile_Size(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, &RotatingFileOpts{MaxSize: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"line 1\n", "line 2\n", "line 3\n"} {
+		f.Write([]byte(line))
+	}
+	f.Close()
+	rotated, _ := f.Rotated()
+	if len(rotated) != 2 {
+		t.Fatalf("got rotated %q, want 2 files", rotated)
+	}
+	for i, want := range []string{"line 1\n", "line 2\n"} {
+		if got := readRotated(t, rotated[i]); got != want {
+			t.Errorf("%s: got %q, want %q", rotated[i], got, want)
+		}
+	}
+	if got := readRotated(t, path); got != "line 3\n" {
+		t.Errorf("got %q, want line 3", got)
+	}
+}
+
+func TestRotatingFile_Interval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, &RotatingFileOpts{Interval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write([]byte("old\n"))
+	time.Sleep(40 * time.Millisecond)
+	f.Write([]byte("new\n"))
+	rotated, _ := f.Rotated()
+	if len(rotated) != 1 || readRotated(t, rotated[0]) != "old\n" {
+		t.Fatalf("got rotated %q, want 1 file with old", rotated)
+	}
+	if got := readRotated(t, path); got != "new\n" {
+		t.Errorf("got %q, want new", got)
+	}
+}
+
+func TestRotatingFile_MaxFilesCompress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, &RotatingFileOpts{MaxFiles: 2, Compress: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"1\n", "2\n", "3\n", "4\n"} {
+		f.Write([]byte(line))
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.Close()
+	rotated, _ := f.Rotated()
+	if len(rotated) != 2 {
+		t.Fatalf("got rotated %q, want 2 files", rotated)
+	}
+	for i, want := range []string{"3\n", "4\n"} {
+		if !strings.HasSuffix(rotated[i], ".gz") {
+			t.Errorf("%s is not compressed", rotated[i])
+		}
+		if got := readRotated(t, rotated[i]); got != want {
+			t.Errorf("%s: got %q, want %q", rotated[i], got, want)
+		}
+	}
+}
+
+func TestRotatingFile_Reopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("before\n"))
+	// external rotation, like logrotate
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("after\n"))
+	f.Close()
+	if got := readRotated(t, path+".1"); got != "before\n" {
+		t.Errorf("got %q, want before", got)
+	}
+	if got := readRotated(t, path); got != "after\n" {
+		t.Errorf("got %q, want after", got)
+	}
+	if _, err := f.Write([]byte("closed\n")); err != os.ErrClosed {
+		t.Errorf("got %v after Close, want os.ErrClosed", err)
+	}
+	if err := f.Reopen(); err != os.ErrClosed {
+		t.Errorf("got Reopen %v after Close, want os.ErrClosed", err)
+	}
+}
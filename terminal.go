@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"io"
 	"os"
+
+	"github.com/mgutz/ansi"
 )
 
 type ColorWriterFunc func(w io.Writer, useColor bool, color []byte, s string, args ...interface{})
@@ -34,6 +36,12 @@ var (
 	reset = []byte{'\033', '[', '0', 'm'}
 )
 
+// Color returns the ANSI color of the mgutz/ansi color code, like "red" or
+// "green+b".
+func Color(code string) []byte {
+	return []byte(ansi.ColorCode(code))
+}
+
 var isTTY bool
 
 func init() {
@@ -0,0 +1,147 @@
+package middleware
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+const (
+	// TraceParentHeader is the W3C trace context parent header.
+	TraceParentHeader = "traceparent"
+	// TraceStateHeader is the W3C trace context state header.
+	TraceStateHeader = "tracestate"
+)
+
+// TraceCtxKey is the key that holds the request *TraceContext.
+var TraceCtxKey = &contextKey{"TraceContext"}
+
+// TraceContext is the W3C trace context of a request.
+type TraceContext struct {
+	// TraceID is the hex encoded 16 bytes trace ID.
+	TraceID string
+	// SpanID is the hex encoded 8 bytes span ID of the request.
+	SpanID string
+	// ParentSpanID is the span ID received on the traceparent header, if any.
+	ParentSpanID string
+	// Flags is the hex encoded trace flags, like "01" when sampled.
+	Flags string
+	// State is the tracestate header value.
+	State string
+}
+
+// Sampled reports whether the sampled flag is set.
+func (tc *TraceContext) Sampled() bool {
+	b, err := hex.DecodeString(tc.Flags)
+	return err == nil && len(b) == 1 && b[0]&1 == 1
+}
+
+// TraceParent returns the traceparent header value of the request span.
+func (tc *TraceContext) TraceParent() string {
+	return "00-" + tc.TraceID + "-" + tc.SpanID + "-" + tc.Flags
+}
+
+// ParseTraceParent parses the traceparent header value. The received span ID
+// is returned as the ParentSpanID.
+func ParseTraceParent(value string) (tc *TraceContext, ok bool) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" {
+		return nil, false
+	}
+	// version 00 has exactly 4 fields, future versions may add more
+	if parts[0] == "00" && len(parts) != 4 {
+		return nil, false
+	}
+	traceID, spanID, flags := parts[1], parts[2], parts[3]
+	if !isTraceHex(parts[0], 2) || !isTraceHex(traceID, 32) || !isTraceHex(spanID, 16) || !isTraceHex(flags, 2) {
+		return nil, false
+	}
+	if isTraceZero(traceID) || isTraceZero(spanID) {
+		return nil, false
+	}
+	return &TraceContext{TraceID: traceID, ParentSpanID: spanID, Flags: flags}, true
+}
+
+// NewTraceContext returns a trace context with new trace and span IDs.
+func NewTraceContext() *TraceContext {
+	return &TraceContext{TraceID: newTraceID(16), SpanID: newTraceID(8), Flags: "01"}
+}
+
+// TraceParent is a middleware that parses the W3C traceparent and tracestate
+// request headers, or starts a new trace if missing or invalid, and creates
+// a span ID for the request. The trace context is stored in the request
+// context and echoed on the traceparent and tracestate response headers.
+func TraceParent(next http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		tc, ok := ParseTraceParent(r.Header.Get(TraceParentHeader))
+		if ok {
+			tc.SpanID = newTraceID(8)
+			tc.State = r.Header.Get(TraceStateHeader)
+		} else {
+			tc = NewTraceContext()
+		}
+		w.Header().Set(TraceParentHeader, tc.TraceParent())
+		if tc.State != "" {
+			w.Header().Set(TraceStateHeader, tc.State)
+		}
+		next.ServeHTTP(w, r.WithContext(WithTraceContext(r.Context(), tc)))
+	}
+	return http.HandlerFunc(fn)
+}
+
+// WithTraceContext returns a copy of the context with the trace context.
+func WithTraceContext(ctx context.Context, tc *TraceContext) context.Context {
+	return context.WithValue(ctx, TraceCtxKey, tc)
+}
+
+// GetTraceContext returns the trace context from the context, or nil.
+func GetTraceContext(ctx context.Context) *TraceContext {
+	tc, _ := ctx.Value(TraceCtxKey).(*TraceContext)
+	return tc
+}
+
+// GetTraceID returns the trace ID from the context, or empty.
+func GetTraceID(ctx context.Context) string {
+	if tc := GetTraceContext(ctx); tc != nil {
+		return tc.TraceID
+	}
+	return ""
+}
+
+// GetSpanID returns the request span ID from the context, or empty.
+func GetSpanID(ctx context.Context) string {
+	if tc := GetTraceContext(ctx); tc != nil {
+		return tc.SpanID
+	}
+	return ""
+}
+
+func newTraceID(size int) string {
+	b := make([]byte, size)
+	for {
+		rand.Read(b)
+		for _, c := range b {
+			if c != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
+
+func isTraceHex(s string, size int) bool {
+	if len(s) != size {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func isTraceZero(s string) bool {
+	return strings.Trim(s, "0") == ""
+}
@@ -0,0 +1,62 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseTraceParent(t *testing.T) {
+	tests := []struct {
+		value string
+		ok    bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", true},
+		{"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", true},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", false},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", false},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", false},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if _, ok := ParseTraceParent(tt.value); ok != tt.ok {
+			t.Errorf("%q: got %v, want %v", tt.value, ok, tt.ok)
+		}
+	}
+}
+
+func TestTraceParent(t *testing.T) {
+	var out bytes.Buffer
+	h := TraceParent(RequestLogger(NewJSONLogFormatter(&out, &out))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(TraceParentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.Header.Set(TraceStateHeader, "congo=t61rcWkgMzE")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var rec JSONLogRecord
+	if err := json.Unmarshal(out.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || rec.SpanID == "" || rec.SpanID == "00f067aa0ba902b7" {
+		t.Errorf("unexpected trace: %q %q", rec.TraceID, rec.SpanID)
+	}
+	if got, want := w.Header().Get(TraceParentHeader), "00-"+rec.TraceID+"-"+rec.SpanID+"-01"; got != want {
+		t.Errorf("traceparent: got %q, want %q", got, want)
+	}
+	if got := w.Header().Get(TraceStateHeader); got != "congo=t61rcWkgMzE" {
+		t.Errorf("tracestate: got %q", got)
+	}
+
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if tc, ok := ParseTraceParent(w.Header().Get(TraceParentHeader)); !ok || tc.TraceID == rec.TraceID {
+		t.Errorf("new trace not started: %q", w.Header().Get(TraceParentHeader))
+	}
+}